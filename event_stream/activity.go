@@ -0,0 +1,102 @@
+package event_stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+)
+
+// Error types of the non-retryable errors returned by the activities.
+const (
+	InvalidTransferErrorType   = "InvalidTransfer"
+	UnknownAccountErrorType    = "UnknownAccount"
+	InsufficientFundsErrorType = "InsufficientFunds"
+)
+
+// Activities move money on a Ledger. Entries are keyed by the transfer
+// reference ID and the activity ID, which stays the same across retries, so a
+// retried activity never applies its entry twice. The withdrawal is keyed by
+// the reference ID alone, so that its refund can void it.
+type Activities struct {
+	Ledger *Ledger
+	// Latency is slept in each activity to make the event stream observable.
+	Latency time.Duration
+}
+
+func (a *Activities) ValidateTransfer(ctx context.Context, input TransferInput) (bool, error) {
+	activity.GetLogger(ctx).Info("Validating transfer", "from", input.FromAccount, "to", input.ToAccount, "amount", input.Amount)
+	a.sleep(ctx)
+	if input.Amount <= 0 {
+		return false, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("invalid amount %.2f", input.Amount), InvalidTransferErrorType, nil)
+	}
+	if input.FromAccount == input.ToAccount {
+		return false, temporal.NewNonRetryableApplicationError(
+			"cannot transfer to the same account", InvalidTransferErrorType, nil)
+	}
+	balance, err := a.Ledger.Balance(input.FromAccount)
+	if err != nil {
+		return false, ledgerError(err)
+	}
+	if _, err := a.Ledger.Balance(input.ToAccount); err != nil {
+		return false, ledgerError(err)
+	}
+	if balance < input.Amount {
+		return false, ledgerError(fmt.Errorf("%w: %s holds %.2f", ErrInsufficientFunds, input.FromAccount, balance))
+	}
+	return true, nil
+}
+
+func (a *Activities) Withdraw(ctx context.Context, input TransferInput) error {
+	activity.GetLogger(ctx).Info("Withdrawing", "account", input.FromAccount, "amount", input.Amount)
+	a.sleep(ctx)
+	return ledgerError(a.Ledger.Debit(withdrawalKey(input), input.FromAccount, input.Amount))
+}
+
+func (a *Activities) Deposit(ctx context.Context, input TransferInput) error {
+	activity.GetLogger(ctx).Info("Depositing", "account", input.ToAccount, "amount", input.Amount)
+	a.sleep(ctx)
+	return ledgerError(a.Ledger.Credit(idempotencyKey(ctx, input), input.ToAccount, input.Amount))
+}
+
+// Refund voids the withdrawal: the amount withdrawn from the source account is
+// credited back, and a withdrawal that did not happen yet never will.
+func (a *Activities) Refund(ctx context.Context, input TransferInput) error {
+	activity.GetLogger(ctx).Info("Refunding", "account", input.FromAccount, "amount", input.Amount)
+	a.sleep(ctx)
+	return ledgerError(a.Ledger.Void(withdrawalKey(input), input.FromAccount, input.Amount))
+}
+
+func (a *Activities) sleep(ctx context.Context) {
+	select {
+	case <-time.After(a.Latency):
+	case <-ctx.Done():
+	}
+}
+
+// idempotencyKey identifies the ledger entry of the current activity.
+func idempotencyKey(ctx context.Context, input TransferInput) string {
+	info := activity.GetInfo(ctx)
+	return fmt.Sprintf("%s/%s/%s", input.ReferenceID, info.ActivityType.Name, info.ActivityID)
+}
+
+// withdrawalKey identifies the ledger entry of the withdrawal of a transfer.
+func withdrawalKey(input TransferInput) string {
+	return input.ReferenceID + "/Withdraw"
+}
+
+// ledgerError turns the ledger errors retrying cannot fix into non-retryable
+// application errors.
+func ledgerError(err error) error {
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		return temporal.NewNonRetryableApplicationError(err.Error(), InsufficientFundsErrorType, err)
+	case errors.Is(err, ErrUnknownAccount):
+		return temporal.NewNonRetryableApplicationError(err.Error(), UnknownAccountErrorType, err)
+	}
+	return err
+}
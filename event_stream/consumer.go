@@ -0,0 +1,33 @@
+package event_stream
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/client"
+)
+
+// Consume calls handle with the events emitted on topic by workflowID, resuming
+// after the offset saved for consumer and saving the offset of each event once
+// handle returned. Events are thus delivered at least once: an event whose
+// handling was interrupted is delivered again after a restart. Consume returns
+// when the workflow is closed, ctx is done or handle fails.
+func Consume[T any](ctx context.Context, c client.Client, store OffsetStore, consumer, workflowID, topic string,
+	options SubscribeOptions, handle func(ctx context.Context, event Event[T]) error) error {
+	from, err := store.Load(ctx, consumer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, wait := Subscribe[T](ctx, c, workflowID, topic, from, options)
+	for event := range events {
+		if err := handle(ctx, event); err != nil {
+			return err
+		}
+		if err := store.Save(ctx, consumer, event.Offset); err != nil {
+			return err
+		}
+	}
+	return wait()
+}
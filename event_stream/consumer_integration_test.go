@@ -0,0 +1,65 @@
+//go:build integration
+
+// The tests in this file run against a dev server, which StartDevServer
+// downloads on first use:
+//
+//	go test -tags integration ./event_stream/
+
+package event_stream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+// chainedTransferWorkflow emits a step per run, continuing as new until all
+// steps were emitted, and waits between steps so that consumers catch up.
+func chainedTransferWorkflow(ctx workflow.Context, steps []string) error {
+	Emit(ctx, TransferTopic, TransferEvent{Step: steps[0]})
+	if err := workflow.Sleep(ctx, 200*time.Millisecond); err != nil {
+		return err
+	}
+	if len(steps) == 1 {
+		return nil
+	}
+	return workflow.NewContinueAsNewError(ctx, chainedTransferWorkflow, steps[1:])
+}
+
+func Test_Consume_DevServer(t *testing.T) {
+	ctx := context.Background()
+	server, err := testsuite.StartDevServer(ctx, testsuite.DevServerOptions{LogLevel: "error"})
+	require.NoError(t, err)
+	defer server.Stop()
+	c := server.Client()
+
+	taskQueue := "event-stream-test"
+	w := worker.New(c, taskQueue, worker.Options{})
+	w.RegisterWorkflow(chainedTransferWorkflow)
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	var want []string
+	for i := 0; i < 6; i++ {
+		want = append(want, fmt.Sprintf("step-%d", i))
+	}
+	run, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{TaskQueue: taskQueue},
+		chainedTransferWorkflow, want)
+	require.NoError(t, err)
+
+	// Restart the consumer mid-stream, while the workflow is still running.
+	// Start from the first run, which may have continued as new already.
+	store := NewMemoryOffsetStore()
+	require.NoError(t, store.Save(ctx, "test", Offset{RunID: run.GetRunID()}))
+	steps := consumeSteps(t, c, store, run.GetID(), 2)
+	steps = append(steps, consumeSteps(t, c, store, run.GetID(), 2)...)
+	steps = append(steps, consumeSteps(t, c, store, run.GetID(), 0)...)
+	require.Equal(t, want, steps)
+}
@@ -0,0 +1,54 @@
+package event_stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+)
+
+var errConsumerStopped = errors.New("consumer stopped")
+
+// consumeSteps consumes transfer events until stopAfter events were handled,
+// or the stream ends if stopAfter is 0, and returns the steps it handled.
+func consumeSteps(t *testing.T, c client.Client, store OffsetStore, workflowID string, stopAfter int) []string {
+	var steps []string
+	err := Consume(context.Background(), c, store, "test", workflowID, TransferTopic, SubscribeOptions{},
+		func(ctx context.Context, event Event[TransferEvent]) error {
+			if stopAfter > 0 && len(steps) == stopAfter {
+				return errConsumerStopped
+			}
+			steps = append(steps, event.Payload.Step)
+			return nil
+		})
+	if stopAfter > 0 {
+		require.ErrorIs(t, err, errConsumerStopped)
+	} else {
+		require.NoError(t, err)
+	}
+	return steps
+}
+
+func Test_Consume_ResumesAfterRestart(t *testing.T) {
+	c := newFakeHistoryClient(t, converter.GetDefaultDataConverter())
+	store, err := NewFileOffsetStore(t.TempDir())
+	require.NoError(t, err)
+
+	// The first consumer stops before continue-as-new, the second one right
+	// after it, and the third one finishes the stream.
+	var steps []string
+	steps = append(steps, consumeSteps(t, c, store, "transfer", 1)...)
+	steps = append(steps, consumeSteps(t, c, store, "transfer", 2)...)
+	steps = append(steps, consumeSteps(t, c, store, "transfer", 0)...)
+	require.Equal(t, []string{"transfer_initiated", "validation", "withdraw", "deposit"}, steps)
+
+	offset, err := store.Load(context.Background(), "test")
+	require.NoError(t, err)
+	require.Equal(t, Offset{RunID: "run-2", EventID: 3}, offset)
+
+	// Once the chain is consumed, a restarted consumer has nothing left to handle.
+	require.Empty(t, consumeSteps(t, c, store, "transfer", 0))
+}
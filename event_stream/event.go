@@ -0,0 +1,51 @@
+package event_stream
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// markerIDPrefix namespaces the markers recorded by Emit.
+	markerIDPrefix = "event_stream/"
+	// envelopeKind tells the markers recorded by Emit apart from the workflow's
+	// own MutableSideEffect markers.
+	envelopeKind = "event_stream"
+	// defaultSchemaVersion is the version of events not implementing SchemaVersioner.
+	defaultSchemaVersion = 1
+)
+
+// SchemaVersioner is implemented by events declaring the version of their
+// schema, so that consumers can tell old and new payloads apart.
+type SchemaVersioner interface {
+	SchemaVersion() int
+}
+
+// envelope is the marker payload recorded by Emit. Subscribers read the topic
+// from it rather than from the marker ID, whose format is internal to the SDK.
+type envelope[T any] struct {
+	Kind          string
+	Topic         string
+	SchemaVersion int
+	Event         T
+}
+
+// Emit records event on topic in the workflow history, where Subscribe picks
+// it up. Events are recorded as markers dedicated to the topic; the SDK does
+// not let workflows name markers, so they are MutableSideEffect markers whose
+// ID is reserved for the topic, which keeps them apart from the workflow's own
+// side effects.
+func Emit[T any](ctx workflow.Context, topic string, event T) {
+	version := defaultSchemaVersion
+	if v, ok := any(event).(SchemaVersioner); ok {
+		version = v.SchemaVersion()
+	}
+	e := envelope[T]{Kind: envelopeKind, Topic: topic, SchemaVersion: version, Event: event}
+	// Never equal to the previous event, so that every call records a marker.
+	workflow.MutableSideEffect(ctx, markerID(topic),
+		func(ctx workflow.Context) interface{} { return e },
+		func(a, b interface{}) bool { return false })
+}
+
+func markerID(topic string) string {
+	return markerIDPrefix + topic
+}
@@ -0,0 +1,90 @@
+package event_stream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrUnknownAccount    = errors.New("unknown account")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// Ledger is an in-process ledger of account balances. Every entry carries an
+// idempotency key, and an entry applied once is never applied again, so that
+// retried activities never debit or credit an account twice.
+type Ledger struct {
+	mu       sync.Mutex
+	balances map[string]float64
+	applied  map[string]bool
+}
+
+// NewLedger creates a ledger holding the given accounts and balances.
+func NewLedger(balances map[string]float64) *Ledger {
+	l := &Ledger{balances: make(map[string]float64), applied: make(map[string]bool)}
+	for account, balance := range balances {
+		l.balances[account] = balance
+	}
+	return l
+}
+
+// Balance returns the balance of account.
+func (l *Ledger) Balance(account string) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	balance, ok := l.balances[account]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+	return balance, nil
+}
+
+// Debit withdraws amount from account, unless the entry key was applied already.
+func (l *Ledger) Debit(key, account string, amount float64) error {
+	return l.apply(key, account, -amount)
+}
+
+// Credit deposits amount to account, unless the entry key was applied already.
+func (l *Ledger) Credit(key, account string, amount float64) error {
+	return l.apply(key, account, amount)
+}
+
+// Void cancels the debit entry key of amount from account: if it was applied,
+// amount is credited back; otherwise the entry is marked as applied, so that a
+// debit still in flight never applies it. Voiding an entry twice has no effect.
+func (l *Ledger) Void(key, account string, amount float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	voidKey := key + "/void"
+	if l.applied[voidKey] {
+		return nil
+	}
+	balance, ok := l.balances[account]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+	if l.applied[key] {
+		l.balances[account] = balance + amount
+	}
+	l.applied[key], l.applied[voidKey] = true, true
+	return nil
+}
+
+func (l *Ledger) apply(key, account string, amount float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.applied[key] {
+		return nil
+	}
+	balance, ok := l.balances[account]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+	if balance+amount < 0 {
+		return fmt.Errorf("%w: %s holds %.2f", ErrInsufficientFunds, account, balance)
+	}
+	l.balances[account] = balance + amount
+	l.applied[key] = true
+	return nil
+}
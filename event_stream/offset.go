@@ -0,0 +1,94 @@
+package event_stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Offset is the position of a consumer in the history of a workflow: the last
+// event it processed. The zero Offset starts at the beginning of the current run.
+type Offset struct {
+	RunID   string
+	EventID int64
+}
+
+// OffsetStore persists the offsets of consumers, so that a restarted consumer
+// resumes after the last event it processed.
+type OffsetStore interface {
+	// Load returns the offset saved for consumer, or the zero Offset.
+	Load(ctx context.Context, consumer string) (Offset, error)
+	Save(ctx context.Context, consumer string, offset Offset) error
+}
+
+// MemoryOffsetStore keeps offsets in memory, for consumers that do not need
+// to survive a restart of the process.
+type MemoryOffsetStore struct {
+	mu      sync.Mutex
+	offsets map[string]Offset
+}
+
+// NewMemoryOffsetStore creates an empty in-memory store.
+func NewMemoryOffsetStore() *MemoryOffsetStore {
+	return &MemoryOffsetStore{offsets: make(map[string]Offset)}
+}
+
+func (s *MemoryOffsetStore) Load(ctx context.Context, consumer string) (Offset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offsets[consumer], nil
+}
+
+func (s *MemoryOffsetStore) Save(ctx context.Context, consumer string, offset Offset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets[consumer] = offset
+	return nil
+}
+
+// FileOffsetStore keeps each consumer's offset in a JSON file in a directory.
+type FileOffsetStore struct {
+	dir string
+}
+
+// NewFileOffsetStore creates a store keeping offsets in dir, creating it if needed.
+func NewFileOffsetStore(dir string) (*FileOffsetStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileOffsetStore{dir: dir}, nil
+}
+
+func (s *FileOffsetStore) Load(ctx context.Context, consumer string) (Offset, error) {
+	var offset Offset
+	data, err := os.ReadFile(s.path(consumer))
+	if errors.Is(err, os.ErrNotExist) {
+		return offset, nil
+	}
+	if err != nil {
+		return offset, err
+	}
+	err = json.Unmarshal(data, &offset)
+	return offset, err
+}
+
+// Save writes the offset to a temporary file first, so that a crash never
+// leaves a truncated offset behind.
+func (s *FileOffsetStore) Save(ctx context.Context, consumer string, offset Offset) error {
+	data, err := json.Marshal(offset)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(consumer) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(consumer))
+}
+
+func (s *FileOffsetStore) path(consumer string) string {
+	return filepath.Join(s.dir, consumer+".json")
+}
@@ -0,0 +1,63 @@
+package event_stream
+
+import (
+	"errors"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// ProgressQueryName query name returning the TransferProgress of a transfer
+	ProgressQueryName = "progress"
+	// CancelTransferUpdateName update name for canceling a transfer before the withdrawal
+	CancelTransferUpdateName = "cancel-transfer"
+
+	// TransferCanceledErrorType is the type of the error a transfer canceled
+	// with CancelTransferUpdateName fails with.
+	TransferCanceledErrorType = "TransferCanceled"
+)
+
+// TransferProgress is the result of the ProgressQueryName query.
+type TransferProgress struct {
+	// Step is the step in progress, or the last step once the transfer is Done.
+	Step string
+	// Events are the TransferEvents emitted so far.
+	Events []TransferEvent
+	Done   bool
+}
+
+// transferState tracks a transfer for the query and update handlers.
+type transferState struct {
+	progress     TransferProgress
+	withdrawing  bool
+	cancelReason string
+}
+
+func (s *transferState) record(event TransferEvent) {
+	s.progress.Step = event.Step
+	s.progress.Events = append(s.progress.Events, event)
+}
+
+func (s *transferState) registerHandlers(ctx workflow.Context) error {
+	if err := workflow.SetQueryHandler(ctx, ProgressQueryName, func() (TransferProgress, error) {
+		return s.progress, nil
+	}); err != nil {
+		return err
+	}
+	return workflow.SetUpdateHandlerWithOptions(ctx, CancelTransferUpdateName,
+		func(ctx workflow.Context, reason string) error {
+			s.cancelReason = reason
+			return nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, reason string) error {
+				if reason == "" {
+					return errors.New("a reason is required")
+				}
+				if s.withdrawing || s.progress.Done {
+					return errors.New("the withdrawal has started, the transfer can no longer be canceled")
+				}
+				return nil
+			},
+		})
+}
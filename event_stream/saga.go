@@ -0,0 +1,52 @@
+package event_stream
+
+import (
+	"errors"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// Saga collects the compensations of the steps a workflow completed, to undo
+// them if a later step fails or the workflow is canceled.
+type Saga struct {
+	// OnCompensate, if set, is called after each compensation with its error.
+	OnCompensate  func(ctx workflow.Context, name string, err error)
+	compensations []compensation
+}
+
+type compensation struct {
+	name string
+	fn   func(ctx workflow.Context) error
+}
+
+// AddCompensation registers fn to undo the step that just completed.
+func (s *Saga) AddCompensation(name string, fn func(ctx workflow.Context) error) {
+	s.compensations = append(s.compensations, compensation{name: name, fn: fn})
+}
+
+// Pending returns the number of compensations registered and not run yet.
+func (s *Saga) Pending() int {
+	return len(s.compensations)
+}
+
+// Compensate runs the registered compensations in reverse order. They run in a
+// context disconnected from ctx, so that they still run once the workflow is
+// canceled. A failed compensation does not stop the following ones; Compensate
+// returns their joined errors.
+func (s *Saga) Compensate(ctx workflow.Context) error {
+	ctx, _ = workflow.NewDisconnectedContext(ctx)
+	var errs []error
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		c := s.compensations[i]
+		err := c.fn(ctx)
+		if err != nil {
+			workflow.GetLogger(ctx).Error("Compensation failed", "Compensation", c.name, "Error", err)
+			errs = append(errs, err)
+		}
+		if s.OnCompensate != nil {
+			s.OnCompensate(ctx, c.name, err)
+		}
+	}
+	s.compensations = nil
+	return errors.Join(errs...)
+}
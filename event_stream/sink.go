@@ -0,0 +1,181 @@
+package event_stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sink publishes the events of workflows to external consumers.
+type Sink interface {
+	// Publish sends event, emitted by workflowID, to the consumers of workflowID.
+	Publish(ctx context.Context, workflowID string, event TransferEvent) error
+	// Close ends the stream of workflowID, e.g. once the workflow completed.
+	Close(workflowID string) error
+}
+
+type multiSink []Sink
+
+// MultiSink returns a Sink publishing to every sink.
+func MultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Publish(ctx context.Context, workflowID string, event TransferEvent) error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Publish(ctx, workflowID, event))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close(workflowID string) error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close(workflowID))
+	}
+	return errors.Join(errs...)
+}
+
+// JSONSink writes one JSON object per event, e.g. to stdout.
+type JSONSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonLine struct {
+	WorkflowID string        `json:"workflowId"`
+	Event      TransferEvent `json:"event"`
+}
+
+// NewJSONSink creates a sink writing JSON lines to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+func (s *JSONSink) Publish(ctx context.Context, workflowID string, event TransferEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(jsonLine{WorkflowID: workflowID, Event: event})
+}
+
+func (s *JSONSink) Close(workflowID string) error {
+	return nil
+}
+
+// hub fans the events of each workflow out to its subscribers. Subscribers
+// joining late first receive the events published so far. An ended stream is
+// forgotten after retention, which leaves clients time to reconnect and read
+// the end of it; a stream without events once its subscribers left.
+type hub struct {
+	mu        sync.Mutex
+	streams   map[string]*stream
+	retention time.Duration
+}
+
+type stream struct {
+	events      []TransferEvent
+	closed      bool
+	subscribers map[*subscription]struct{}
+}
+
+// subscription receives the events of a stream on events, which is closed when
+// the stream ends or when the subscriber is disconnected for falling behind.
+type subscription struct {
+	events chan TransferEvent
+	// overflowed is set before events is closed if the subscriber was
+	// disconnected rather than the stream ended.
+	overflowed bool
+}
+
+// endedStreamRetention is how long the events of an ended stream are kept.
+const endedStreamRetention = time.Minute
+
+func newHub() *hub {
+	return &hub{streams: make(map[string]*stream), retention: endedStreamRetention}
+}
+
+func (h *hub) stream(workflowID string) *stream {
+	s, ok := h.streams[workflowID]
+	if !ok {
+		s = &stream{subscribers: make(map[*subscription]struct{})}
+		h.streams[workflowID] = s
+	}
+	return s
+}
+
+// forget removes the stream of workflowID unless it was replaced already.
+func (h *hub) forget(workflowID string, s *stream) {
+	if h.streams[workflowID] == s {
+		delete(h.streams, workflowID)
+	}
+}
+
+func (h *hub) Publish(ctx context.Context, workflowID string, event TransferEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.stream(workflowID)
+	s.events = append(s.events, event)
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			// A subscriber that does not keep up is disconnected rather
+			// than holding up the others.
+			delete(s.subscribers, sub)
+			sub.overflowed = true
+			close(sub.events)
+		}
+	}
+	return nil
+}
+
+func (h *hub) Close(workflowID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.stream(workflowID)
+	s.closed = true
+	for sub := range s.subscribers {
+		close(sub.events)
+	}
+	clear(s.subscribers)
+	time.AfterFunc(h.retention, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.forget(workflowID, s)
+	})
+	return nil
+}
+
+// subscribe returns a subscription to the events of workflowID and a function
+// to unsubscribe.
+func (h *hub) subscribe(workflowID string) (*subscription, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.stream(workflowID)
+	sub := &subscription{events: make(chan TransferEvent, len(s.events)+subscriberBuffer)}
+	for _, event := range s.events {
+		sub.events <- event
+	}
+	if s.closed {
+		close(sub.events)
+		return sub, func() {}
+	}
+	s.subscribers[sub] = struct{}{}
+	return sub, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := s.subscribers[sub]; ok {
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+		if len(s.subscribers) == 0 && len(s.events) == 0 {
+			h.forget(workflowID, s)
+		}
+	}
+}
+
+const subscriberBuffer = 64
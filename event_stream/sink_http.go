@@ -0,0 +1,118 @@
+package event_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/websocket"
+)
+
+// WorkflowIDPathValue is the path wildcard the HTTP sinks read the workflow ID
+// from, e.g. mux.Handle("GET /events/{workflowID}", sink).
+const WorkflowIDPathValue = "workflowID"
+
+// SSESink serves the events of a workflow as Server-Sent Events. Each event
+// carries its index as SSE id, so a reconnecting EventSource resumes after the
+// last event it received. An "end" event is sent once the stream is closed. A
+// client that falls behind is sent an "overflow" event and disconnected; an
+// EventSource reconnects and resumes on its own.
+type SSESink struct {
+	*hub
+}
+
+// NewSSESink creates a Server-Sent Events sink to be mounted on a route with
+// the WorkflowIDPathValue wildcard.
+func NewSSESink() *SSESink {
+	return &SSESink{hub: newHub()}
+}
+
+func (s *SSESink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	next := 0
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.Atoi(lastEventID)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		next = id + 1
+	}
+
+	sub, unsubscribe := s.subscribe(r.PathValue(WorkflowIDPathValue))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for id := 0; ; id++ {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok && sub.overflowed {
+				fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			if !ok {
+				fmt.Fprint(w, "event: end\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			if id < next {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: transfer\ndata: %s\n\n", id, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// WebSocketSink serves the events of a workflow as JSON WebSocket messages
+// and closes the connection once the stream is closed. A client that falls
+// behind is sent an {"error": "overflow"} message before the connection is
+// closed.
+type WebSocketSink struct {
+	*hub
+}
+
+// NewWebSocketSink creates a WebSocket sink to be mounted on a route with the
+// WorkflowIDPathValue wildcard.
+func NewWebSocketSink() *WebSocketSink {
+	return &WebSocketSink{hub: newHub()}
+}
+
+func (s *WebSocketSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		sub, unsubscribe := s.subscribe(r.PathValue(WorkflowIDPathValue))
+		defer unsubscribe()
+		// Clients do not send anything; reading detects when they disconnect.
+		go func() {
+			_, _ = io.Copy(io.Discard, ws)
+			unsubscribe()
+		}()
+		for event := range sub.events {
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		}
+		if sub.overflowed {
+			_ = websocket.JSON.Send(ws, map[string]string{"error": "overflow"})
+		}
+	}).ServeHTTP(w, r)
+}
@@ -0,0 +1,144 @@
+package event_stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func Test_HTTPSinks(t *testing.T) {
+	sse, ws := NewSSESink(), NewWebSocketSink()
+	sink := MultiSink(sse, ws)
+	mux := http.NewServeMux()
+	mux.Handle("GET /events/{workflowID}", sse)
+	mux.Handle("GET /ws/{workflowID}", ws)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	events := []TransferEvent{
+		{Step: "transfer_initiated", Status: "started"},
+		{Step: "withdraw", Status: "completed"},
+		{Step: "transfer_completed", Status: "success"},
+	}
+	// The first event is published before anyone subscribes, and another
+	// workflow's events must not leak into the stream.
+	require.NoError(t, sink.Publish(ctx, "transfer-1", events[0]))
+	require.NoError(t, sink.Publish(ctx, "transfer-2", TransferEvent{Step: "other"}))
+
+	resp, err := http.Get(server.URL + "/events/transfer-1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/transfer-1"
+	conn, err := websocket.Dial(wsURL, "", server.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, event := range events[1:] {
+		require.NoError(t, sink.Publish(ctx, "transfer-1", event))
+	}
+	require.NoError(t, sink.Close("transfer-1"))
+
+	var received []TransferEvent
+	for {
+		var event TransferEvent
+		if err := websocket.JSON.Receive(conn, &event); err != nil {
+			break
+		}
+		received = append(received, event)
+	}
+	require.Equal(t, events, received)
+
+	received = nil
+	var lastEvent string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			lastEvent = name
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && lastEvent == "transfer" {
+			var event TransferEvent
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			received = append(received, event)
+		}
+	}
+	require.Equal(t, events, received)
+	require.Equal(t, "end", lastEvent)
+
+	// A reconnecting EventSource resumes after the last event it received.
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events/transfer-1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var ids []string
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	require.Equal(t, []string{"2"}, ids)
+}
+
+func Test_Hub_DisconnectsSlowSubscribers(t *testing.T) {
+	h := newHub()
+	ctx := context.Background()
+	slow, unsubscribe := h.subscribe("transfer-1")
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		require.NoError(t, h.Publish(ctx, "transfer-1", TransferEvent{Step: "withdraw"}))
+	}
+	received := 0
+	for range slow.events {
+		received++
+	}
+	require.Equal(t, subscriberBuffer, received)
+	require.True(t, slow.overflowed)
+
+	// Subscribers of an ended stream are not told they overflowed.
+	done, _ := h.subscribe("transfer-1")
+	require.NoError(t, h.Close("transfer-1"))
+	for range done.events {
+	}
+	require.False(t, done.overflowed)
+}
+
+func Test_Hub_ForgetsEndedStreams(t *testing.T) {
+	h := newHub()
+	h.retention = 10 * time.Millisecond
+	ctx := context.Background()
+
+	// An ended stream is kept for clients reconnecting within the retention.
+	require.NoError(t, h.Publish(ctx, "transfer-1", TransferEvent{Step: "withdraw"}))
+	sub, unsubscribe := h.subscribe("transfer-1")
+	defer unsubscribe()
+	require.NoError(t, h.Close("transfer-1"))
+	for range sub.events {
+	}
+	late, _ := h.subscribe("transfer-1")
+	require.Len(t, late.events, 1)
+	require.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.streams) == 0
+	}, time.Second, time.Millisecond)
+
+	// Subscribing to a workflow without events leaves nothing behind.
+	_, unsubscribe = h.subscribe("transfer-2")
+	unsubscribe()
+	require.Empty(t, h.streams)
+}
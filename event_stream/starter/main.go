@@ -2,70 +2,136 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/google/uuid"
-	enumspb "go.temporal.io/api/enums/v1"
 	"go.temporal.io/sdk/client"
-	"go.temporal.io/sdk/converter"
 
 	es "github.com/taonic/my-samples-go/event_stream"
 )
 
 func main() {
+	httpAddr := flag.String("http", "", "serve the events over HTTP on this address, e.g. localhost:8080")
+	workflowID := flag.String("w", "", "stream the events of this workflow instead of starting a new one")
+	offsetsDir := flag.String("offsets", "", "save the stream offset in this directory to resume after a restart")
+	mode := flag.String("progress", "history", "follow the transfer progress from the workflow history or by polling the progress query: history|query")
+	cancel := flag.String("cancel", "", "cancel the transfer before the withdrawal, with this reason")
+	flag.Parse()
+	if *mode != "history" && *mode != "query" {
+		log.Fatalln("Unknown progress mode", *mode)
+	}
+
 	c, err := client.Dial(client.Options{})
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
 	}
 	defer c.Close()
 
-	workflowID := "money-transfer-" + uuid.NewString()[:8]
-	run, err := c.ExecuteWorkflow(context.Background(), client.StartWorkflowOptions{
-		ID:        workflowID,
-		TaskQueue: es.TaskQueue,
-	}, es.MoneyTransferWorkflow, es.TransferInput{
-		FromAccount: "ACC-001",
-		ToAccount:   "ACC-002",
-		Amount:      250.00,
-		ReferenceID: workflowID,
-	})
-	if err != nil {
-		log.Fatalln("Unable to start workflow", err)
+	sink := es.Sink(es.NewJSONSink(os.Stdout))
+	if *httpAddr != "" {
+		sse, ws := es.NewSSESink(), es.NewWebSocketSink()
+		mux := http.NewServeMux()
+		mux.Handle("GET /events/{"+es.WorkflowIDPathValue+"}", sse)
+		mux.Handle("GET /ws/{"+es.WorkflowIDPathValue+"}", ws)
+		go func() {
+			log.Fatalln(http.ListenAndServe(*httpAddr, mux))
+		}()
+		sink = es.MultiSink(sink, sse, ws)
 	}
-	log.Printf("Started workflow %s (run %s)\n", run.GetID(), run.GetRunID())
 
-	// Long-poll workflow history for SideEffect marker events
-	ctx := context.Background()
-	iter := c.GetWorkflowHistory(ctx, run.GetID(), run.GetRunID(), true, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	var store es.OffsetStore = es.NewMemoryOffsetStore()
+	if *offsetsDir != "" {
+		if store, err = es.NewFileOffsetStore(*offsetsDir); err != nil {
+			log.Fatalln("Unable to create offset store", err)
+		}
+	}
 
-	dc := converter.GetDefaultDataConverter()
-	for iter.HasNext() {
-		event, err := iter.Next()
+	if *workflowID == "" {
+		*workflowID = "money-transfer-" + uuid.NewString()[:8]
+		run, err := c.ExecuteWorkflow(context.Background(), client.StartWorkflowOptions{
+			ID:        *workflowID,
+			TaskQueue: es.TaskQueue,
+		}, es.MoneyTransferWorkflow, es.TransferInput{
+			FromAccount: "ACC-001",
+			ToAccount:   "ACC-002",
+			Amount:      250.00,
+			ReferenceID: *workflowID,
+		})
 		if err != nil {
-			log.Fatalln("Error reading history", err)
+			log.Fatalln("Unable to start workflow", err)
 		}
+		log.Printf("Started workflow %s (run %s)\n", run.GetID(), run.GetRunID())
+	}
+	if *httpAddr != "" {
+		log.Printf("Streaming events on http://%s/events/%s and ws://%s/ws/%s\n",
+			*httpAddr, *workflowID, *httpAddr, *workflowID)
+	}
 
-		attrs := event.GetMarkerRecordedEventAttributes()
-		if attrs == nil || attrs.GetMarkerName() != "SideEffect" {
-			continue
-		}
+	if *cancel != "" {
+		go cancelTransfer(c, *workflowID, *cancel)
+	}
 
-		dataPayloads, ok := attrs.GetDetails()["data"]
-		if !ok || len(dataPayloads.GetPayloads()) == 0 {
-			continue
-		}
+	if *mode == "query" {
+		err = pollProgress(context.Background(), c, *workflowID, sink)
+	} else {
+		// Long-poll workflow history for transfer events
+		err = es.PublishEvents(context.Background(), c, store, "starter-"+*workflowID, *workflowID,
+			es.SubscribeOptions{}, sink)
+	}
+	if err != nil {
+		log.Fatalln("Unable to stream events", err)
+	}
+	log.Println("Workflow completed")
 
-		var te es.TransferEvent
-		if err := dc.FromPayload(dataPayloads.GetPayloads()[0], &te); err != nil {
-			log.Printf("Failed to decode event: %v", err)
-			continue
-		}
+	if *httpAddr != "" {
+		log.Println("Still serving the event stream, press Ctrl+C to exit")
+		select {}
+	}
+}
 
-		pretty, _ := json.MarshalIndent(te, "", "  ")
-		fmt.Printf("📌 Event: %s\n", pretty)
+// pollProgress publishes the TransferEvents returned by the progress query
+// until the transfer is done.
+func pollProgress(ctx context.Context, c client.Client, workflowID string, sink es.Sink) error {
+	published := 0
+	for {
+		resp, err := c.QueryWorkflow(ctx, workflowID, "", es.ProgressQueryName)
+		if err != nil {
+			return err
+		}
+		var progress es.TransferProgress
+		if err := resp.Get(&progress); err != nil {
+			return err
+		}
+		for _, event := range progress.Events[published:] {
+			if err := sink.Publish(ctx, workflowID, event); err != nil {
+				return err
+			}
+		}
+		published = len(progress.Events)
+		if progress.Done {
+			return sink.Close(workflowID)
+		}
+		time.Sleep(500 * time.Millisecond)
 	}
+}
 
-	log.Println("Workflow completed")
+func cancelTransfer(c client.Client, workflowID, reason string) {
+	handle, err := c.UpdateWorkflow(context.Background(), client.UpdateWorkflowOptions{
+		WorkflowID:   workflowID,
+		UpdateName:   es.CancelTransferUpdateName,
+		Args:         []interface{}{reason},
+		WaitForStage: client.WorkflowUpdateStageCompleted,
+	})
+	if err == nil {
+		err = handle.Get(context.Background(), nil)
+	}
+	if err != nil {
+		log.Println("Unable to cancel transfer", err)
+		return
+	}
+	log.Println("Transfer canceled")
 }
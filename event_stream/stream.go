@@ -0,0 +1,22 @@
+package event_stream
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/client"
+)
+
+// PublishEvents publishes the TransferEvents of a workflow to sink and closes
+// the stream of workflowID once the workflow is closed. It resumes after the
+// offset saved for consumer in store.
+func PublishEvents(ctx context.Context, c client.Client, store OffsetStore, consumer, workflowID string,
+	options SubscribeOptions, sink Sink) error {
+	err := Consume(ctx, c, store, consumer, workflowID, TransferTopic, options,
+		func(ctx context.Context, event Event[TransferEvent]) error {
+			return sink.Publish(ctx, workflowID, event.Payload)
+		})
+	if err != nil {
+		return err
+	}
+	return sink.Close(workflowID)
+}
@@ -0,0 +1,144 @@
+package event_stream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+)
+
+// Marker name and detail key the SDK records MutableSideEffect markers with.
+const (
+	mutableSideEffectMarkerName = "MutableSideEffect"
+	sideEffectDataDetail        = "data"
+)
+
+// Event is an event emitted with Emit, as received from Subscribe.
+type Event[T any] struct {
+	// Offset locates the event in the workflow history. Subscribe from it to
+	// resume after this event.
+	Offset        Offset
+	Time          time.Time
+	Topic         string
+	SchemaVersion int
+	Payload       T
+}
+
+// SubscribeOptions configure Subscribe and Consume.
+type SubscribeOptions struct {
+	// DataConverter decodes the events, and must match the one of the workers
+	// running the workflow. Defaults to converter.GetDefaultDataConverter().
+	DataConverter converter.DataConverter
+}
+
+// Subscribe streams the events emitted on topic by the workflow workflowID
+// after from, following the workflow into the next run when it continues as
+// new. The returned channel is closed when the last run of the chain closes or
+// ctx is done; the returned function then reports why.
+func Subscribe[T any](ctx context.Context, c client.Client, workflowID, topic string,
+	from Offset, options SubscribeOptions) (<-chan Event[T], func() error) {
+	dc := options.DataConverter
+	if dc == nil {
+		dc = converter.GetDefaultDataConverter()
+	}
+	events := make(chan Event[T])
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		defer close(events)
+		err = followHistory(ctx, c, workflowID, from, func(runID string, historyEvent *historypb.HistoryEvent) error {
+			event, ok, err := decodeEvent[T](dc, runID, topic, historyEvent)
+			if err != nil || !ok {
+				return err
+			}
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return events, func() error {
+		<-done
+		return err
+	}
+}
+
+// followHistory long-polls the history of a workflow, after from and across
+// continue-as-new, calling handle with every event.
+func followHistory(ctx context.Context, c client.Client, workflowID string, from Offset,
+	handle func(runID string, event *historypb.HistoryEvent) error) error {
+	runID, afterEventID := from.RunID, from.EventID
+	if runID == "" {
+		resp, err := c.DescribeWorkflowExecution(ctx, workflowID, "")
+		if err != nil {
+			return err
+		}
+		runID = resp.GetWorkflowExecutionInfo().GetExecution().GetRunId()
+	}
+
+	for {
+		nextRunID := ""
+		iter := c.GetWorkflowHistory(ctx, workflowID, runID, true, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+		for iter.HasNext() {
+			event, err := iter.Next()
+			if err != nil {
+				return fmt.Errorf("reading history of run %s: %w", runID, err)
+			}
+			if event.GetEventId() <= afterEventID {
+				continue
+			}
+			if err := handle(runID, event); err != nil {
+				return err
+			}
+			if attrs := event.GetWorkflowExecutionContinuedAsNewEventAttributes(); attrs != nil {
+				nextRunID = attrs.GetNewExecutionRunId()
+			}
+		}
+		if nextRunID == "" {
+			return nil
+		}
+		runID, afterEventID = nextRunID, 0
+	}
+}
+
+// decodeEvent returns the event recorded by Emit on topic in historyEvent, or
+// false if historyEvent is not such an event.
+func decodeEvent[T any](dc converter.DataConverter, runID, topic string,
+	historyEvent *historypb.HistoryEvent) (Event[T], bool, error) {
+	var event Event[T]
+	attrs := historyEvent.GetMarkerRecordedEventAttributes()
+	if attrs == nil || attrs.GetMarkerName() != mutableSideEffectMarkerName {
+		return event, false, nil
+	}
+
+	// The data detail holds the marker ID followed by the recorded value,
+	// which is an envelope for the markers recorded by Emit only.
+	var id string
+	data := &commonpb.Payloads{}
+	if err := dc.FromPayloads(attrs.GetDetails()[sideEffectDataDetail], &id, data); err != nil {
+		return event, false, nil
+	}
+	var header struct{ Kind, Topic string }
+	if err := dc.FromPayloads(data, &header); err != nil || header.Kind != envelopeKind || header.Topic != topic {
+		return event, false, nil
+	}
+	var e envelope[T]
+	if err := dc.FromPayloads(data, &e); err != nil {
+		return event, false, fmt.Errorf("decoding event %d: %w", historyEvent.GetEventId(), err)
+	}
+	return Event[T]{
+		Offset:        Offset{RunID: runID, EventID: historyEvent.GetEventId()},
+		Time:          historyEvent.GetEventTime().AsTime(),
+		Topic:         e.Topic,
+		SchemaVersion: e.SchemaVersion,
+		Payload:       e.Event,
+	}, true, nil
+}
@@ -0,0 +1,185 @@
+package event_stream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+)
+
+// fakeHistoryClient serves fixed workflow histories, keyed by run ID.
+type fakeHistoryClient struct {
+	client.Client
+	currentRunID string
+	runs         map[string][]*historypb.HistoryEvent
+}
+
+func (c *fakeHistoryClient) DescribeWorkflowExecution(ctx context.Context, workflowID, runID string) (*workflowservice.DescribeWorkflowExecutionResponse, error) {
+	return &workflowservice.DescribeWorkflowExecutionResponse{
+		WorkflowExecutionInfo: &workflowpb.WorkflowExecutionInfo{
+			Execution: &commonpb.WorkflowExecution{WorkflowId: workflowID, RunId: c.currentRunID},
+		},
+	}, nil
+}
+
+func (c *fakeHistoryClient) GetWorkflowHistory(ctx context.Context, workflowID, runID string, isLongPoll bool,
+	filterType enumspb.HistoryEventFilterType) client.HistoryEventIterator {
+	return &sliceIterator{events: c.runs[runID]}
+}
+
+type sliceIterator struct {
+	events []*historypb.HistoryEvent
+}
+
+func (it *sliceIterator) HasNext() bool {
+	return len(it.events) > 0
+}
+
+func (it *sliceIterator) Next() (*historypb.HistoryEvent, error) {
+	event := it.events[0]
+	it.events = it.events[1:]
+	return event, nil
+}
+
+// markerEvent builds the MarkerRecorded event the SDK records for the counter-th
+// MutableSideEffect command of the workflow task, the way Emit calls it.
+func markerEvent(t *testing.T, dc converter.DataConverter, eventID int64, id string, counter int,
+	value interface{}) *historypb.HistoryEvent {
+	payloads := func(values ...interface{}) *commonpb.Payloads {
+		p, err := dc.ToPayloads(values...)
+		require.NoError(t, err)
+		return p
+	}
+	return &historypb.HistoryEvent{
+		EventId:   eventID,
+		EventType: enumspb.EVENT_TYPE_MARKER_RECORDED,
+		Attributes: &historypb.HistoryEvent_MarkerRecordedEventAttributes{
+			MarkerRecordedEventAttributes: &historypb.MarkerRecordedEventAttributes{
+				MarkerName: mutableSideEffectMarkerName,
+				Details: map[string]*commonpb.Payloads{
+					"side-effect-id":                   payloads(fmt.Sprintf("%s_%d", id, counter)),
+					sideEffectDataDetail:               payloads(id, payloads(value)),
+					"mutable-side-effect-call-counter": payloads(1),
+				},
+			},
+		},
+	}
+}
+
+func transferMarker(t *testing.T, dc converter.DataConverter, eventID int64, step string) *historypb.HistoryEvent {
+	return markerEvent(t, dc, eventID, markerID(TransferTopic), int(eventID), envelope[TransferEvent]{
+		Kind:          envelopeKind,
+		Topic:         TransferTopic,
+		SchemaVersion: TransferEventSchemaVersion,
+		Event:         TransferEvent{Step: step},
+	})
+}
+
+func continuedAsNewEvent(eventID int64, newRunID string) *historypb.HistoryEvent {
+	return &historypb.HistoryEvent{
+		EventId:   eventID,
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionContinuedAsNewEventAttributes{
+			WorkflowExecutionContinuedAsNewEventAttributes: &historypb.WorkflowExecutionContinuedAsNewEventAttributes{
+				NewExecutionRunId: newRunID,
+			},
+		},
+	}
+}
+
+func newFakeHistoryClient(t *testing.T, dc converter.DataConverter) *fakeHistoryClient {
+	// A plain SideEffect, an event on another topic and a MutableSideEffect of
+	// the workflow's own are skipped.
+	sideEffect := markerEvent(t, dc, 3, "", 0, TransferEvent{Step: "not an event"})
+	sideEffect.GetMarkerRecordedEventAttributes().MarkerName = "SideEffect"
+	otherTopic := markerEvent(t, dc, 4, markerID("audit"), 4,
+		envelope[string]{Kind: envelopeKind, Topic: "audit", Event: "audit"})
+	ownMutableSideEffect := markerEvent(t, dc, 5, markerID(TransferTopic), 5,
+		envelope[string]{Topic: TransferTopic, Event: "not an event"})
+
+	return &fakeHistoryClient{
+		currentRunID: "run-1",
+		runs: map[string][]*historypb.HistoryEvent{
+			"run-1": {
+				{EventId: 1, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED},
+				transferMarker(t, dc, 2, "transfer_initiated"),
+				sideEffect,
+				otherTopic,
+				ownMutableSideEffect,
+				transferMarker(t, dc, 6, "validation"),
+				continuedAsNewEvent(7, "run-2"),
+			},
+			"run-2": {
+				{EventId: 1, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED},
+				transferMarker(t, dc, 2, "withdraw"),
+				transferMarker(t, dc, 3, "deposit"),
+				{EventId: 4, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED},
+			},
+		},
+	}
+}
+
+func Test_Subscribe_FollowsContinueAsNew(t *testing.T) {
+	c := newFakeHistoryClient(t, converter.GetDefaultDataConverter())
+
+	events, wait := Subscribe[TransferEvent](context.Background(), c, "transfer", TransferTopic, Offset{}, SubscribeOptions{})
+	var received []Event[TransferEvent]
+	for event := range events {
+		received = append(received, event)
+	}
+	require.NoError(t, wait())
+
+	var steps, positions []string
+	for _, event := range received {
+		require.Equal(t, TransferTopic, event.Topic)
+		require.Equal(t, TransferEventSchemaVersion, event.SchemaVersion)
+		steps = append(steps, event.Payload.Step)
+		positions = append(positions, fmt.Sprintf("%s/%d", event.Offset.RunID, event.Offset.EventID))
+	}
+	require.Equal(t, []string{"transfer_initiated", "validation", "withdraw", "deposit"}, steps)
+	require.Equal(t, []string{"run-1/2", "run-1/6", "run-2/2", "run-2/3"}, positions)
+}
+
+func Test_Subscribe_ResumesAfterEvent(t *testing.T) {
+	c := newFakeHistoryClient(t, converter.GetDefaultDataConverter())
+
+	events, wait := Subscribe[TransferEvent](context.Background(), c, "transfer", TransferTopic,
+		Offset{RunID: "run-1", EventID: 6}, SubscribeOptions{})
+	var steps []string
+	for event := range events {
+		steps = append(steps, event.Payload.Step)
+	}
+	require.NoError(t, wait())
+	require.Equal(t, []string{"withdraw", "deposit"}, steps)
+}
+
+func Test_Subscribe_UsesDataConverter(t *testing.T) {
+	dc := converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), converter.NewZlibCodec(
+		converter.ZlibCodecOptions{AlwaysEncode: true}))
+	c := newFakeHistoryClient(t, dc)
+
+	events, wait := Subscribe[TransferEvent](context.Background(), c, "transfer", TransferTopic, Offset{},
+		SubscribeOptions{DataConverter: dc})
+	var steps []string
+	for event := range events {
+		steps = append(steps, event.Payload.Step)
+	}
+	require.NoError(t, wait())
+	require.Equal(t, []string{"transfer_initiated", "validation", "withdraw", "deposit"}, steps)
+
+	// The default data converter cannot read the compressed events.
+	events, wait = Subscribe[TransferEvent](context.Background(), c, "transfer", TransferTopic, Offset{},
+		SubscribeOptions{})
+	for range events {
+		t.Fatal("decoded a compressed event")
+	}
+	require.NoError(t, wait())
+}
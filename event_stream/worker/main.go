@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
@@ -18,9 +19,13 @@ func main() {
 
 	w := worker.New(c, es.TaskQueue, worker.Options{})
 	w.RegisterWorkflow(es.MoneyTransferWorkflow)
-	w.RegisterActivity(es.ValidateTransfer)
-	w.RegisterActivity(es.Withdraw)
-	w.RegisterActivity(es.Deposit)
+	w.RegisterActivity(&es.Activities{
+		Ledger: es.NewLedger(map[string]float64{
+			"ACC-001": 1000.00,
+			"ACC-002": 500.00,
+		}),
+		Latency: time.Second,
+	})
 
 	if err := w.Run(worker.InterruptCh()); err != nil {
 		log.Fatalln("Unable to start worker", err)
@@ -1,15 +1,22 @@
 package event_stream
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"time"
 
-	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
-const TaskQueue = "event-stream-queue"
+const (
+	TaskQueue = "event-stream-queue"
+
+	// TransferTopic is the topic MoneyTransferWorkflow emits TransferEvents on.
+	TransferTopic = "transfer"
+	// TransferEventSchemaVersion is the current version of TransferEvent.
+	TransferEventSchemaVersion = 1
+)
 
 type TransferEvent struct {
 	Step      string    `json:"step"`
@@ -20,6 +27,10 @@ type TransferEvent struct {
 	Message   string    `json:"message,omitempty"`
 }
 
+func (TransferEvent) SchemaVersion() int {
+	return TransferEventSchemaVersion
+}
+
 type TransferInput struct {
 	FromAccount string
 	ToAccount   string
@@ -27,16 +38,62 @@ type TransferInput struct {
 	ReferenceID string
 }
 
-func MoneyTransferWorkflow(ctx workflow.Context, input TransferInput) error {
+// MoneyTransferWorkflow withdraws from one account and deposits to another.
+// If the transfer fails or is canceled once the withdrawal started, the
+// withdrawal is refunded. Until the withdrawal starts, the transfer can be
+// canceled with the CancelTransferUpdateName update; its progress is exposed
+// by the ProgressQueryName query.
+func MoneyTransferWorkflow(ctx workflow.Context, input TransferInput) (err error) {
 	ao := workflow.ActivityOptions{StartToCloseTimeout: 30 * time.Second}
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
+	state := &transferState{}
+	if err := state.registerHandlers(ctx); err != nil {
+		return err
+	}
+	emit := func(ctx workflow.Context, event TransferEvent) {
+		state.record(event)
+		Emit(ctx, TransferTopic, event)
+	}
 	emitEvent := func(event TransferEvent) {
-		workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
-			return event
-		})
+		emit(ctx, event)
 	}
 
+	// Runs last, once the transfer is compensated.
+	defer func() { state.progress.Done = true }()
+
+	var a *Activities
+	saga := &Saga{OnCompensate: func(ctx workflow.Context, name string, err error) {
+		event := TransferEvent{Step: name, Status: "compensated", Timestamp: workflow.Now(ctx)}
+		if err != nil {
+			event.Status, event.Message = "compensation_failed", err.Error()
+		}
+		emit(ctx, event)
+	}}
+	defer func() {
+		if err == nil {
+			return
+		}
+		step, status := "transfer_failed", "failed"
+		var appErr *temporal.ApplicationError
+		if errors.Is(ctx.Err(), workflow.ErrCanceled) ||
+			errors.As(err, &appErr) && appErr.Type() == TransferCanceledErrorType {
+			step, status = "transfer_canceled", "canceled"
+		}
+		if saga.Pending() > 0 {
+			status = "compensated"
+		}
+		if cerr := saga.Compensate(ctx); cerr != nil {
+			status = "compensation_failed"
+			err = errors.Join(err, cerr)
+		}
+		// The workflow may be canceled, so emit from a disconnected context.
+		dctx, _ := workflow.NewDisconnectedContext(ctx)
+		emit(dctx, TransferEvent{
+			Step: step, Status: status, Timestamp: workflow.Now(dctx), Message: err.Error(),
+		})
+	}()
+
 	emitEvent(TransferEvent{
 		Step: "transfer_initiated", Status: "started",
 		Amount: input.Amount, Message: fmt.Sprintf("Transfer %s -> %s", input.FromAccount, input.ToAccount),
@@ -44,8 +101,9 @@ func MoneyTransferWorkflow(ctx workflow.Context, input TransferInput) error {
 	})
 
 	// Validate
+	state.progress.Step = "validation"
 	var valid bool
-	if err := workflow.ExecuteActivity(ctx, ValidateTransfer, input).Get(ctx, &valid); err != nil {
+	if err := workflow.ExecuteActivity(ctx, a.ValidateTransfer, input).Get(ctx, &valid); err != nil {
 		return err
 	}
 	emitEvent(TransferEvent{
@@ -54,7 +112,21 @@ func MoneyTransferWorkflow(ctx workflow.Context, input TransferInput) error {
 	})
 
 	// Withdraw
-	if err := workflow.ExecuteActivity(ctx, Withdraw, input.FromAccount, input.Amount).Get(ctx, nil); err != nil {
+	if state.cancelReason != "" {
+		return temporal.NewNonRetryableApplicationError("transfer canceled: "+state.cancelReason,
+			TransferCanceledErrorType, nil)
+	}
+	state.progress.Step, state.withdrawing = "withdraw", true
+	err = workflow.ExecuteActivity(ctx, a.Withdraw, input).Get(ctx, nil)
+	// Unless the withdrawal reported a failure, the debit may be applied, even
+	// if the transfer was canceled or the withdrawal timed out meanwhile.
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) {
+		saga.AddCompensation("refund", func(ctx workflow.Context) error {
+			return workflow.ExecuteActivity(ctx, a.Refund, input).Get(ctx, nil)
+		})
+	}
+	if err != nil {
 		return err
 	}
 	emitEvent(TransferEvent{
@@ -63,7 +135,8 @@ func MoneyTransferWorkflow(ctx workflow.Context, input TransferInput) error {
 	})
 
 	// Deposit
-	if err := workflow.ExecuteActivity(ctx, Deposit, input.ToAccount, input.Amount).Get(ctx, nil); err != nil {
+	state.progress.Step = "deposit"
+	if err := workflow.ExecuteActivity(ctx, a.Deposit, input).Get(ctx, nil); err != nil {
 		return err
 	}
 	emitEvent(TransferEvent{
@@ -78,21 +151,3 @@ func MoneyTransferWorkflow(ctx workflow.Context, input TransferInput) error {
 
 	return nil
 }
-
-func ValidateTransfer(ctx context.Context, input TransferInput) (bool, error) {
-	activity.GetLogger(ctx).Info("Validating transfer", "from", input.FromAccount, "to", input.ToAccount, "amount", input.Amount)
-	time.Sleep(500 * time.Millisecond)
-	return true, nil
-}
-
-func Withdraw(ctx context.Context, account string, amount float64) error {
-	activity.GetLogger(ctx).Info("Withdrawing", "account", account, "amount", amount)
-	time.Sleep(1 * time.Second)
-	return nil
-}
-
-func Deposit(ctx context.Context, account string, amount float64) error {
-	activity.GetLogger(ctx).Info("Depositing", "account", account, "amount", amount)
-	time.Sleep(1 * time.Second)
-	return nil
-}
@@ -0,0 +1,348 @@
+package event_stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+// eventRecorder records the TransferEvents emitted by the workflows it
+// intercepts, as "step/status".
+type eventRecorder struct {
+	interceptor.WorkerInterceptorBase
+	events []string
+}
+
+func (r *eventRecorder) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &recordingInbound{WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next}, recorder: r}
+}
+
+type recordingInbound struct {
+	interceptor.WorkflowInboundInterceptorBase
+	recorder *eventRecorder
+}
+
+func (i *recordingInbound) Init(outbound interceptor.WorkflowOutboundInterceptor) error {
+	return i.Next.Init(&recordingOutbound{
+		WorkflowOutboundInterceptorBase: interceptor.WorkflowOutboundInterceptorBase{Next: outbound},
+		recorder:                        i.recorder,
+	})
+}
+
+type recordingOutbound struct {
+	interceptor.WorkflowOutboundInterceptorBase
+	recorder *eventRecorder
+}
+
+func (o *recordingOutbound) MutableSideEffect(ctx workflow.Context, id string,
+	f func(ctx workflow.Context) interface{}, equals func(a, b interface{}) bool) converter.EncodedValue {
+	if e, ok := f(ctx).(envelope[TransferEvent]); ok && id == markerID(TransferTopic) {
+		o.recorder.events = append(o.recorder.events, e.Event.Step+"/"+e.Event.Status)
+	}
+	return o.Next.MutableSideEffect(ctx, id, f, equals)
+}
+
+// newTransferTestEnv creates a test environment running the activities
+// against a ledger where ACC-001 holds 1000 and ACC-002 holds 500.
+func newTransferTestEnv(t *testing.T) (*testsuite.TestWorkflowEnvironment, *Activities, *eventRecorder) {
+	var ts testsuite.WorkflowTestSuite
+	env := ts.NewTestWorkflowEnvironment()
+	recorder := &eventRecorder{}
+	env.SetWorkerOptions(worker.Options{Interceptors: []interceptor.WorkerInterceptor{recorder}})
+	a := &Activities{Ledger: NewLedger(map[string]float64{"ACC-001": 1000, "ACC-002": 500})}
+	env.RegisterWorkflow(MoneyTransferWorkflow)
+	env.RegisterActivity(a)
+	return env, a, recorder
+}
+
+func requireBalances(t *testing.T, ledger *Ledger, from, to float64) {
+	balance, err := ledger.Balance("ACC-001")
+	require.NoError(t, err)
+	require.Equal(t, from, balance)
+	balance, err = ledger.Balance("ACC-002")
+	require.NoError(t, err)
+	require.Equal(t, to, balance)
+}
+
+var testTransfer = TransferInput{FromAccount: "ACC-001", ToAccount: "ACC-002", Amount: 250, ReferenceID: "ref-1"}
+
+func Test_MoneyTransferWorkflow_Compensation(t *testing.T) {
+	failure := temporal.NewNonRetryableApplicationError("injected failure", "Injected", nil)
+	tests := []struct {
+		name     string
+		failAt   string
+		refunded bool
+		events   []string
+	}{
+		{
+			name: "success",
+			events: []string{"transfer_initiated/started", "validation/completed", "withdraw/completed",
+				"deposit/completed", "transfer_completed/success"},
+		},
+		{
+			name:   "validation fails",
+			failAt: "validation",
+			events: []string{"transfer_initiated/started", "transfer_failed/failed"},
+		},
+		{
+			name:   "withdraw fails",
+			failAt: "withdraw",
+			events: []string{"transfer_initiated/started", "validation/completed", "transfer_failed/failed"},
+		},
+		{
+			name:     "deposit fails",
+			failAt:   "deposit",
+			refunded: true,
+			events: []string{"transfer_initiated/started", "validation/completed", "withdraw/completed",
+				"refund/compensated", "transfer_failed/compensated"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failIf := func(step string) error {
+				if tt.failAt == step {
+					return failure
+				}
+				return nil
+			}
+			env, a, recorder := newTransferTestEnv(t)
+			env.OnActivity(a.ValidateTransfer, mock.Anything, testTransfer).Return(true, failIf("validation")).Maybe()
+			env.OnActivity(a.Withdraw, mock.Anything, testTransfer).Return(failIf("withdraw")).Maybe()
+			env.OnActivity(a.Deposit, mock.Anything, testTransfer).Return(failIf("deposit")).Maybe()
+			refund := env.OnActivity(a.Refund, mock.Anything, testTransfer).Return(nil)
+			if tt.refunded {
+				refund.Once()
+			} else {
+				refund.Never()
+			}
+
+			env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+			require.True(t, env.IsWorkflowCompleted())
+			if tt.failAt == "" {
+				require.NoError(t, env.GetWorkflowError())
+			} else {
+				require.ErrorContains(t, env.GetWorkflowError(), "injected failure")
+			}
+			require.Equal(t, tt.events, recorder.events)
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_MoneyTransferWorkflow_CompensationFails(t *testing.T) {
+	env, a, recorder := newTransferTestEnv(t)
+	env.OnActivity(a.ValidateTransfer, mock.Anything, testTransfer).Return(true, nil)
+	env.OnActivity(a.Withdraw, mock.Anything, testTransfer).Return(nil)
+	env.OnActivity(a.Deposit, mock.Anything, testTransfer).
+		Return(temporal.NewNonRetryableApplicationError("deposit failed", "Injected", nil))
+	env.OnActivity(a.Refund, mock.Anything, testTransfer).
+		Return(temporal.NewNonRetryableApplicationError("refund failed", "Injected", nil))
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	require.ErrorContains(t, err, "deposit failed")
+	require.ErrorContains(t, err, "refund failed")
+	require.Equal(t, []string{"transfer_initiated/started", "validation/completed", "withdraw/completed",
+		"refund/compensation_failed", "transfer_failed/compensation_failed"}, recorder.events)
+}
+
+func Test_MoneyTransferWorkflow_CanceledDuringDeposit(t *testing.T) {
+	env, a, recorder := newTransferTestEnv(t)
+	env.OnActivity(a.ValidateTransfer, mock.Anything, testTransfer).Return(true, nil)
+	env.OnActivity(a.Withdraw, mock.Anything, testTransfer).Return(nil)
+	env.OnActivity(a.Deposit, mock.Anything, testTransfer).After(time.Minute).Return(nil)
+	env.OnActivity(a.Refund, mock.Anything, testTransfer).Return(nil).Once()
+	env.RegisterDelayedCallback(env.CancelWorkflow, 10*time.Second)
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var canceled *temporal.CanceledError
+	require.True(t, errors.As(env.GetWorkflowError(), &canceled))
+	require.Equal(t, []string{"transfer_initiated/started", "validation/completed", "withdraw/completed",
+		"refund/compensated", "transfer_canceled/compensated"}, recorder.events)
+	env.AssertExpectations(t)
+}
+
+func Test_MoneyTransferWorkflow_CanceledDuringWithdraw(t *testing.T) {
+	for _, debited := range []bool{false, true} {
+		t.Run(fmt.Sprintf("debited=%v", debited), func(t *testing.T) {
+			env, a, recorder := newTransferTestEnv(t)
+			env.OnActivity(a.Withdraw, mock.Anything, testTransfer).After(time.Minute).Return(nil)
+			env.OnActivity(a.Deposit, mock.Anything, testTransfer).Return(nil).Never()
+			env.RegisterDelayedCallback(func() {
+				// The withdrawal may be applied before its result is reported.
+				if debited {
+					require.NoError(t, a.Ledger.Debit(withdrawalKey(testTransfer), "ACC-001", 250))
+				}
+				env.CancelWorkflow()
+			}, 10*time.Second)
+
+			env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+			require.True(t, env.IsWorkflowCompleted())
+			var canceled *temporal.CanceledError
+			require.True(t, errors.As(env.GetWorkflowError(), &canceled))
+			require.Equal(t, []string{"transfer_initiated/started", "validation/completed",
+				"refund/compensated", "transfer_canceled/compensated"}, recorder.events)
+			requireBalances(t, a.Ledger, 1000, 500)
+
+			// A withdrawal still in flight once refunded does not debit.
+			require.NoError(t, a.Ledger.Debit(withdrawalKey(testTransfer), "ACC-001", 250))
+			requireBalances(t, a.Ledger, 1000, 500)
+		})
+	}
+}
+
+func Test_MoneyTransferWorkflow_Ledger(t *testing.T) {
+	env, a, recorder := newTransferTestEnv(t)
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, "transfer_completed/success", recorder.events[len(recorder.events)-1])
+	requireBalances(t, a.Ledger, 750, 750)
+}
+
+func Test_MoneyTransferWorkflow_InsufficientFunds(t *testing.T) {
+	env, a, _ := newTransferTestEnv(t)
+	// Another transfer drains the source account after the validation.
+	env.SetOnActivityCompletedListener(func(info *activity.Info, result converter.EncodedValue, err error) {
+		if info.ActivityType.Name == "ValidateTransfer" {
+			require.NoError(t, a.Ledger.Debit("other-transfer", "ACC-001", 900))
+		}
+	})
+	attempts := 0
+	env.SetOnActivityStartedListener(func(info *activity.Info, ctx context.Context, args converter.EncodedValues) {
+		if info.ActivityType.Name == "Withdraw" {
+			attempts++
+		}
+	})
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var appErr *temporal.ApplicationError
+	require.True(t, errors.As(env.GetWorkflowError(), &appErr))
+	require.Equal(t, InsufficientFundsErrorType, appErr.Type())
+	require.Equal(t, 1, attempts, "insufficient funds must not be retried")
+	requireBalances(t, a.Ledger, 100, 500)
+}
+
+// crashAfterApply wraps an activity so that its first attempt fails after
+// applying its entry, as if the worker crashed before reporting the result.
+func crashAfterApply(f func(context.Context, TransferInput) error) func(context.Context, TransferInput) error {
+	return func(ctx context.Context, input TransferInput) error {
+		if err := f(ctx, input); err != nil {
+			return err
+		}
+		if activity.GetInfo(ctx).Attempt == 1 {
+			return errors.New("worker crashed")
+		}
+		return nil
+	}
+}
+
+func Test_MoneyTransferWorkflow_RetriesNeverDoubleDebit(t *testing.T) {
+	env, a, _ := newTransferTestEnv(t)
+	options := func(name string) activity.RegisterOptions {
+		return activity.RegisterOptions{Name: name, DisableAlreadyRegisteredCheck: true}
+	}
+	env.RegisterActivityWithOptions(crashAfterApply(a.Withdraw), options("Withdraw"))
+	env.RegisterActivityWithOptions(crashAfterApply(a.Deposit), options("Deposit"))
+	attempts := map[string]int{}
+	env.SetOnActivityStartedListener(func(info *activity.Info, ctx context.Context, args converter.EncodedValues) {
+		attempts[info.ActivityType.Name]++
+	})
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, map[string]int{"ValidateTransfer": 1, "Withdraw": 2, "Deposit": 2}, attempts)
+	requireBalances(t, a.Ledger, 750, 750)
+}
+
+func queryProgress(t *testing.T, env *testsuite.TestWorkflowEnvironment) TransferProgress {
+	result, err := env.QueryWorkflow(ProgressQueryName)
+	require.NoError(t, err)
+	var progress TransferProgress
+	require.NoError(t, result.Get(&progress))
+	return progress
+}
+
+func Test_MoneyTransferWorkflow_CancelBeforeWithdraw(t *testing.T) {
+	env, a, recorder := newTransferTestEnv(t)
+	env.OnActivity(a.ValidateTransfer, mock.Anything, testTransfer).After(10*time.Second).Return(true, nil)
+	env.OnActivity(a.Withdraw, mock.Anything, testTransfer).Return(nil).Never()
+	var updateErr error
+	env.RegisterDelayedCallback(func() {
+		require.Equal(t, "validation", queryProgress(t, env).Step)
+		env.UpdateWorkflow(CancelTransferUpdateName, "cancel-1", &testsuite.TestUpdateCallback{
+			OnAccept:   func() {},
+			OnReject:   func(err error) { updateErr = err },
+			OnComplete: func(result interface{}, err error) { updateErr = err },
+		}, "changed my mind")
+	}, time.Second)
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, updateErr)
+	var appErr *temporal.ApplicationError
+	require.True(t, errors.As(env.GetWorkflowError(), &appErr))
+	require.Equal(t, TransferCanceledErrorType, appErr.Type())
+	require.Equal(t, []string{"transfer_initiated/started", "validation/completed", "transfer_canceled/canceled"},
+		recorder.events)
+
+	progress := queryProgress(t, env)
+	require.True(t, progress.Done)
+	require.Equal(t, "transfer_canceled", progress.Step)
+	require.Len(t, progress.Events, 3)
+	env.AssertExpectations(t)
+}
+
+func Test_MoneyTransferWorkflow_CancelRejectedAfterWithdraw(t *testing.T) {
+	env, a, recorder := newTransferTestEnv(t)
+	env.OnActivity(a.Deposit, mock.Anything, testTransfer).After(time.Minute).Return(nil)
+	var updateErr error
+	env.RegisterDelayedCallback(func() {
+		progress := queryProgress(t, env)
+		require.Equal(t, "deposit", progress.Step)
+		require.False(t, progress.Done)
+		env.UpdateWorkflow(CancelTransferUpdateName, "cancel-1", &testsuite.TestUpdateCallback{
+			OnAccept:   func() {},
+			OnReject:   func(err error) { updateErr = err },
+			OnComplete: func(result interface{}, err error) {},
+		}, "too late")
+	}, 10*time.Second)
+
+	env.ExecuteWorkflow(MoneyTransferWorkflow, testTransfer)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.ErrorContains(t, updateErr, "can no longer be canceled")
+	require.Equal(t, "transfer_completed/success", recorder.events[len(recorder.events)-1])
+
+	progress := queryProgress(t, env)
+	require.True(t, progress.Done)
+	require.Equal(t, "transfer_completed", progress.Step)
+	require.Len(t, progress.Events, len(recorder.events))
+}
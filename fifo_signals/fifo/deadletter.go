@@ -0,0 +1,49 @@
+package fifo
+
+import (
+	"slices"
+	"time"
+)
+
+// DeadLetter is a message that failed every processing attempt.
+type DeadLetter[T any] struct {
+	Message  T
+	Error    string
+	FailedAt time.Time
+}
+
+// DeadLetterQueue keeps the messages that failed every processing attempt
+// until they are replayed.
+type DeadLetterQueue[T any] struct {
+	letters []DeadLetter[T]
+}
+
+// NewDeadLetterQueue creates a queue holding letters, e.g. those carried over
+// from a previous run.
+func NewDeadLetterQueue[T any](letters []DeadLetter[T]) *DeadLetterQueue[T] {
+	return &DeadLetterQueue[T]{letters: slices.Clone(letters)}
+}
+
+// Add dead-letters msg after it failed with err.
+func (q *DeadLetterQueue[T]) Add(msg T, err error, failedAt time.Time) {
+	q.letters = append(q.letters, DeadLetter[T]{Message: msg, Error: err.Error(), FailedAt: failedAt})
+}
+
+// List returns the dead letters, oldest first.
+func (q *DeadLetterQueue[T]) List() []DeadLetter[T] {
+	return slices.Clone(q.letters)
+}
+
+// Remove takes the messages matching match out of the queue, oldest first, so
+// that they can be replayed.
+func (q *DeadLetterQueue[T]) Remove(match func(T) bool) []T {
+	var removed []T
+	q.letters = slices.DeleteFunc(q.letters, func(l DeadLetter[T]) bool {
+		if match(l.Message) {
+			removed = append(removed, l.Message)
+			return true
+		}
+		return false
+	})
+	return removed
+}
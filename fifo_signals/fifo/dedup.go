@@ -0,0 +1,90 @@
+package fifo
+
+// MessageStatus is the processing status of a message ID.
+type MessageStatus string
+
+const (
+	// StatusUnknown is returned for IDs never seen or evicted from the window.
+	StatusUnknown MessageStatus = "unknown"
+	// StatusAccepted is returned for messages queued but not processed yet.
+	StatusAccepted MessageStatus = "accepted"
+	// StatusProcessed is returned for messages processed successfully.
+	StatusProcessed MessageStatus = "processed"
+	// StatusDeadLettered is returned for messages that failed every attempt.
+	StatusDeadLettered MessageStatus = "dead-lettered"
+)
+
+// DedupEntry is a message ID remembered by a DedupWindow.
+type DedupEntry struct {
+	ID     string
+	Status MessageStatus
+}
+
+// DedupWindow remembers the last size message IDs and their status, so that
+// messages resent by producers are dropped. IDs older than the window are
+// forgotten; a message resent after that is processed again.
+type DedupWindow struct {
+	size    int
+	ids     []string
+	entries map[string]MessageStatus
+}
+
+// NewDedupWindow creates a window of size IDs, restoring the entries of a
+// previous run as returned by Entries.
+func NewDedupWindow(size int, entries []DedupEntry) *DedupWindow {
+	w := &DedupWindow{
+		size:    size,
+		entries: make(map[string]MessageStatus, size),
+	}
+	for _, e := range entries {
+		w.remember(e.ID, e.Status)
+	}
+	return w
+}
+
+// Accept records id as accepted and returns true, or returns false if id is
+// in the window already. Empty IDs are always accepted and never remembered.
+func (w *DedupWindow) Accept(id string) bool {
+	if id == "" {
+		return true
+	}
+	if _, ok := w.entries[id]; ok {
+		return false
+	}
+	w.remember(id, StatusAccepted)
+	return true
+}
+
+// Mark updates the status of id if it is in the window.
+func (w *DedupWindow) Mark(id string, status MessageStatus) {
+	if _, ok := w.entries[id]; ok {
+		w.entries[id] = status
+	}
+}
+
+// Status returns the status of id.
+func (w *DedupWindow) Status(id string) MessageStatus {
+	if status, ok := w.entries[id]; ok {
+		return status
+	}
+	return StatusUnknown
+}
+
+// Entries returns the remembered IDs from oldest to newest, to be carried over
+// on continue-as-new.
+func (w *DedupWindow) Entries() []DedupEntry {
+	entries := make([]DedupEntry, 0, len(w.ids))
+	for _, id := range w.ids {
+		entries = append(entries, DedupEntry{ID: id, Status: w.entries[id]})
+	}
+	return entries
+}
+
+func (w *DedupWindow) remember(id string, status MessageStatus) {
+	w.ids = append(w.ids, id)
+	w.entries[id] = status
+	for len(w.ids) > w.size {
+		delete(w.entries, w.ids[0])
+		w.ids = w.ids[1:]
+	}
+}
@@ -0,0 +1,33 @@
+package fifo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DedupWindow(t *testing.T) {
+	w := NewDedupWindow(3, nil)
+	require.True(t, w.Accept("a"))
+	require.True(t, w.Accept("b"))
+	require.False(t, w.Accept("a"))
+	require.True(t, w.Accept(""))
+	require.True(t, w.Accept(""))
+
+	w.Mark("a", StatusProcessed)
+	require.Equal(t, StatusProcessed, w.Status("a"))
+	require.Equal(t, StatusAccepted, w.Status("b"))
+
+	// The window survives continue-as-new and forgets the oldest IDs.
+	w = NewDedupWindow(3, w.Entries())
+	require.False(t, w.Accept("b"))
+	require.True(t, w.Accept("c"))
+	require.True(t, w.Accept("d"))
+	require.Equal(t, StatusUnknown, w.Status("a"))
+	require.Equal(t, []DedupEntry{
+		{ID: "b", Status: StatusAccepted},
+		{ID: "c", Status: StatusAccepted},
+		{ID: "d", Status: StatusAccepted},
+	}, w.Entries())
+	require.True(t, w.Accept("a"))
+}
@@ -0,0 +1,156 @@
+package fifo
+
+import (
+	"slices"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// KeyedDispatcher processes messages with the same key strictly one after the
+// other in arrival order, and messages with different keys concurrently up to
+// a limit. A message whose handler fails blocks its key, and only its key,
+// until Unblock is called.
+type KeyedDispatcher[T any] struct {
+	limit   int
+	key     func(T) string
+	handler func(ctx workflow.Context, msg T) error
+
+	pending map[string][]keyedMessage[T]
+	running map[string]bool
+	blocked map[string]string
+	seq     int
+	stopped bool
+}
+
+type keyedMessage[T any] struct {
+	seq int
+	msg T
+}
+
+// NewKeyedDispatcher creates a dispatcher running handler for at most limit
+// keys at a time. A limit below 1 processes one key at a time.
+func NewKeyedDispatcher[T any](limit int, key func(T) string,
+	handler func(ctx workflow.Context, msg T) error) *KeyedDispatcher[T] {
+	if limit < 1 {
+		limit = 1
+	}
+	return &KeyedDispatcher[T]{
+		limit:   limit,
+		key:     key,
+		handler: handler,
+		pending: make(map[string][]keyedMessage[T]),
+		running: make(map[string]bool),
+		blocked: make(map[string]string),
+	}
+}
+
+// Add queues msgs behind the messages already queued for their keys and starts
+// processing the keys that are free.
+func (d *KeyedDispatcher[T]) Add(ctx workflow.Context, msgs ...T) {
+	for _, msg := range msgs {
+		key := d.key(msg)
+		d.pending[key] = append(d.pending[key], keyedMessage[T]{seq: d.seq, msg: msg})
+		d.seq++
+	}
+	d.dispatch(ctx)
+}
+
+// Block stops processing key, e.g. to restore the blocked keys of a previous run.
+func (d *KeyedDispatcher[T]) Block(key, reason string) {
+	d.blocked[key] = reason
+}
+
+// Unblock resumes processing key, starting with the message that failed. It
+// returns false if key was not blocked.
+func (d *KeyedDispatcher[T]) Unblock(ctx workflow.Context, key string) bool {
+	if _, ok := d.blocked[key]; !ok {
+		return false
+	}
+	delete(d.blocked, key)
+	d.dispatch(ctx)
+	return true
+}
+
+// Stop stops starting new messages, e.g. before continuing as new. Messages
+// already being processed run to completion, see Running.
+func (d *KeyedDispatcher[T]) Stop() {
+	d.stopped = true
+}
+
+// Blocked returns the blocked keys and the error that blocked each of them.
+func (d *KeyedDispatcher[T]) Blocked() map[string]string {
+	blocked := make(map[string]string, len(d.blocked))
+	for key, reason := range d.blocked {
+		blocked[key] = reason
+	}
+	return blocked
+}
+
+// Running returns the number of messages being processed.
+func (d *KeyedDispatcher[T]) Running() int {
+	return len(d.running)
+}
+
+// Len returns the number of messages not processed yet, see Pending.
+func (d *KeyedDispatcher[T]) Len() int {
+	n := 0
+	for _, queued := range d.pending {
+		n += len(queued)
+	}
+	return n
+}
+
+// Pending returns the messages not processed yet, including the failed
+// messages of blocked keys and the messages being processed, in arrival order.
+func (d *KeyedDispatcher[T]) Pending() []T {
+	var all []keyedMessage[T]
+	for _, queued := range d.pending {
+		all = append(all, queued...)
+	}
+	slices.SortFunc(all, func(a, b keyedMessage[T]) int { return a.seq - b.seq })
+	msgs := make([]T, 0, len(all))
+	for _, m := range all {
+		msgs = append(msgs, m.msg)
+	}
+	return msgs
+}
+
+// dispatch starts the free keys whose head message arrived first until the
+// limit is reached. Keys are picked in arrival order of their head message so
+// that processing follows the overall arrival order as closely as possible.
+func (d *KeyedDispatcher[T]) dispatch(ctx workflow.Context) {
+	for !d.stopped && len(d.running) < d.limit {
+		next, nextSeq := "", -1
+		for key, queued := range d.pending {
+			if _, blocked := d.blocked[key]; blocked || d.running[key] || len(queued) == 0 {
+				continue
+			}
+			if nextSeq < 0 || queued[0].seq < nextSeq {
+				next, nextSeq = key, queued[0].seq
+			}
+		}
+		if nextSeq < 0 {
+			return
+		}
+		d.start(ctx, next)
+	}
+}
+
+func (d *KeyedDispatcher[T]) start(ctx workflow.Context, key string) {
+	d.running[key] = true
+	msg := d.pending[key][0].msg
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		err := d.handler(ctx, msg)
+		delete(d.running, key)
+		if err != nil {
+			workflow.GetLogger(ctx).Error("message failed, blocking its key", "key", key, "Error", err)
+			d.blocked[key] = err.Error()
+		} else {
+			d.pending[key] = d.pending[key][1:]
+			if len(d.pending[key]) == 0 {
+				delete(d.pending, key)
+			}
+		}
+		d.dispatch(ctx)
+	})
+}
@@ -0,0 +1,156 @@
+package fifo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	keyedTestMessage struct {
+		Key      string
+		Seq      int
+		Duration time.Duration
+		Fail     bool
+	}
+
+	processedMessage struct {
+		Key        string
+		Seq        int
+		Start, End time.Time
+	}
+
+	keyedTestResult struct {
+		Processed []processedMessage
+		// Blocked and Pending are captured once every free key has been processed.
+		Blocked map[string]string
+		Pending []int
+	}
+)
+
+// keyedWorkflow dispatches msgs with a limit of 2 keys. A failing message
+// fails once, and its key is unblocked after the other keys are done.
+func keyedWorkflow(ctx workflow.Context, msgs []keyedTestMessage) (keyedTestResult, error) {
+	var result keyedTestResult
+	failed := make(map[int]bool)
+	dispatcher := NewKeyedDispatcher(2,
+		func(msg keyedTestMessage) string { return msg.Key },
+		func(ctx workflow.Context, msg keyedTestMessage) error {
+			start := workflow.Now(ctx)
+			_ = workflow.Sleep(ctx, msg.Duration)
+			if msg.Fail && !failed[msg.Seq] {
+				failed[msg.Seq] = true
+				return errors.New("poison message")
+			}
+			result.Processed = append(result.Processed, processedMessage{
+				Key: msg.Key, Seq: msg.Seq, Start: start, End: workflow.Now(ctx),
+			})
+			return nil
+		})
+	dispatcher.Add(ctx, msgs...)
+
+	if err := workflow.Await(ctx, func() bool { return dispatcher.Running() == 0 }); err != nil {
+		return result, err
+	}
+	result.Blocked = dispatcher.Blocked()
+	for _, msg := range dispatcher.Pending() {
+		result.Pending = append(result.Pending, msg.Seq)
+	}
+	for key := range result.Blocked {
+		dispatcher.Unblock(ctx, key)
+	}
+	err := workflow.Await(ctx, func() bool { return dispatcher.Running() == 0 })
+	return result, err
+}
+
+func Test_KeyedDispatcher(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	msgs := []keyedTestMessage{
+		{Key: "a", Seq: 0, Duration: 10 * time.Second},
+		{Key: "a", Seq: 1, Duration: time.Second},
+		{Key: "b", Seq: 2, Duration: time.Second},
+		{Key: "b", Seq: 3, Duration: time.Second, Fail: true},
+		{Key: "b", Seq: 4, Duration: time.Second},
+		{Key: "c", Seq: 5, Duration: time.Second},
+		{Key: "a", Seq: 6, Duration: time.Second},
+	}
+	env.ExecuteWorkflow(keyedWorkflow, msgs)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var result keyedTestResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+
+	// The failed message blocked b only, keeping itself and its successor queued.
+	require.Equal(t, []string{"b"}, keys(result.Blocked))
+	require.Equal(t, []int{3, 4}, result.Pending)
+
+	byKey := make(map[string][]processedMessage)
+	for _, p := range result.Processed {
+		byKey[p.Key] = append(byKey[p.Key], p)
+	}
+	require.Len(t, result.Processed, len(msgs))
+	for key, processed := range byKey {
+		for i := 1; i < len(processed); i++ {
+			require.Less(t, processed[i-1].Seq, processed[i].Seq, "key %s out of order", key)
+			require.False(t, processed[i].Start.Before(processed[i-1].End), "key %s overlapped", key)
+		}
+	}
+	// A slow message on a blocks neither b nor c, which finish while it runs.
+	require.True(t, byKey["c"][0].End.Before(byKey["a"][0].End))
+	require.True(t, byKey["b"][0].End.Before(byKey["a"][0].End))
+}
+
+func keys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// zeroLimitWorkflow dispatches msgs with a zero limit and returns them in the
+// order they were processed.
+func zeroLimitWorkflow(ctx workflow.Context, msgs []keyedTestMessage) ([]processedMessage, error) {
+	var processed []processedMessage
+	dispatcher := NewKeyedDispatcher(0,
+		func(msg keyedTestMessage) string { return msg.Key },
+		func(ctx workflow.Context, msg keyedTestMessage) error {
+			start := workflow.Now(ctx)
+			_ = workflow.Sleep(ctx, msg.Duration)
+			processed = append(processed, processedMessage{
+				Key: msg.Key, Seq: msg.Seq, Start: start, End: workflow.Now(ctx),
+			})
+			return nil
+		})
+	dispatcher.Add(ctx, msgs...)
+	err := workflow.Await(ctx, func() bool { return len(processed) == len(msgs) })
+	return processed, err
+}
+
+func Test_KeyedDispatcher_ZeroLimitProcessesOneKeyAtATime(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	msgs := []keyedTestMessage{
+		{Key: "a", Seq: 0, Duration: time.Second},
+		{Key: "b", Seq: 1, Duration: time.Second},
+		{Key: "a", Seq: 2, Duration: time.Second},
+	}
+	env.ExecuteWorkflow(zeroLimitWorkflow, msgs)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var processed []processedMessage
+	require.NoError(t, env.GetWorkflowResult(&processed))
+	require.Len(t, processed, len(msgs))
+	for i := 1; i < len(processed); i++ {
+		require.False(t, processed[i].Start.Before(processed[i-1].End), "keys overlapped")
+	}
+}
@@ -0,0 +1,101 @@
+// Package fifo provides an ordered queue over a workflow signal channel.
+package fifo
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+// SignalQueue buffers the signals received on a signal channel and hands them
+// to workflow code in arrival order. Messages carried over from a previous run
+// are delivered before any signal received by this run.
+type SignalQueue[T any] struct {
+	channel   workflow.ReceiveChannel
+	buffer    []T
+	processed int
+}
+
+// NewSignalQueue creates a queue over the signalName channel. carried holds the
+// unprocessed messages of the previous run, as returned by Drain.
+func NewSignalQueue[T any](ctx workflow.Context, signalName string, carried []T) *SignalQueue[T] {
+	return &SignalQueue[T]{
+		channel: workflow.GetSignalChannel(ctx, signalName),
+		buffer:  append([]T(nil), carried...),
+	}
+}
+
+// Next blocks until a message is available and returns it. It returns an
+// error only if ctx is canceled.
+func (q *SignalQueue[T]) Next(ctx workflow.Context) (T, error) {
+	var msg T
+	if err := q.await(ctx); err != nil {
+		return msg, err
+	}
+	msg, q.buffer = q.buffer[0], q.buffer[1:]
+	q.processed++
+	return msg, nil
+}
+
+// Batch blocks until at least one message is available and returns up to n
+// messages without waiting for more. It returns an error only if ctx is canceled.
+func (q *SignalQueue[T]) Batch(ctx workflow.Context, n int) ([]T, error) {
+	if err := q.await(ctx); err != nil {
+		return nil, err
+	}
+	for len(q.buffer) < n && q.receiveAsync() {
+	}
+	n = min(n, len(q.buffer))
+	batch := append([]T(nil), q.buffer[:n]...)
+	q.buffer = q.buffer[n:]
+	q.processed += len(batch)
+	return batch, nil
+}
+
+// Push queues msg behind every signal received so far, e.g. for messages
+// submitted through an update rather than a signal.
+func (q *SignalQueue[T]) Push(msg T) {
+	for q.receiveAsync() {
+	}
+	q.buffer = append(q.buffer, msg)
+}
+
+// Len returns the number of messages waiting to be processed, including
+// signals not yet moved out of the channel.
+func (q *SignalQueue[T]) Len() int {
+	return len(q.buffer) + q.channel.Len()
+}
+
+// Processed returns the number of messages returned by Next and Batch in this run.
+func (q *SignalQueue[T]) Processed() int {
+	return q.processed
+}
+
+// Drain moves every signal received so far out of the channel and returns all
+// unprocessed messages in order. Pass the result to the next run when
+// continuing as new; signals left in the channel would otherwise be lost.
+func (q *SignalQueue[T]) Drain() []T {
+	for q.receiveAsync() {
+	}
+	return append([]T(nil), q.buffer...)
+}
+
+func (q *SignalQueue[T]) await(ctx workflow.Context) error {
+	if len(q.buffer) > 0 {
+		return nil
+	}
+	if err := workflow.Await(ctx, func() bool { return len(q.buffer) > 0 || q.channel.Len() > 0 }); err != nil {
+		return err
+	}
+	if len(q.buffer) == 0 {
+		q.receiveAsync()
+	}
+	return nil
+}
+
+func (q *SignalQueue[T]) receiveAsync() bool {
+	var msg T
+	if !q.channel.ReceiveAsync(&msg) {
+		return false
+	}
+	q.buffer = append(q.buffer, msg)
+	return true
+}
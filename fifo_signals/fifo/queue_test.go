@@ -0,0 +1,80 @@
+package fifo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+const testSignalName = "test-signal"
+
+// orderingWorkflow processes batches of up to batchSize messages, one batch
+// per second, until total messages were processed, continuing as new after
+// maxPerRun messages. seen accumulates the processed messages across runs.
+func orderingWorkflow(ctx workflow.Context, total, batchSize, maxPerRun int, carried, seen []int) ([]int, error) {
+	queue := NewSignalQueue(ctx, testSignalName, carried)
+	for len(seen) < total {
+		batch, err := queue.Batch(ctx, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		seen = append(seen, batch...)
+		_ = workflow.Sleep(ctx, time.Second)
+
+		if queue.Processed() >= maxPerRun {
+			return nil, workflow.NewContinueAsNewError(ctx, orderingWorkflow,
+				total, batchSize, maxPerRun, queue.Drain(), seen)
+		}
+	}
+	return seen, nil
+}
+
+func Test_SignalQueue_OrderAcrossContinueAsNew(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	const total, batchSize, maxPerRun = 300, 7, 50
+
+	// Signals arrive in bursts of 100 while the first run is processing, each
+	// burst delivered in a single workflow task.
+	env := testSuite.NewTestWorkflowEnvironment()
+	for burst := 0; burst < 3; burst++ {
+		env.RegisterDelayedCallback(func() {
+			for i := burst * 100; i < (burst+1)*100-1; i++ {
+				env.SignalWorkflowSkippingWorkflowTask(testSignalName, i)
+			}
+			env.SignalWorkflow(testSignalName, (burst+1)*100-1)
+		}, time.Duration(burst)*time.Second+time.Millisecond)
+	}
+	env.ExecuteWorkflow(orderingWorkflow, total, batchSize, maxPerRun, nil, nil)
+
+	runs := 1
+	for {
+		require.True(t, env.IsWorkflowCompleted())
+		var canErr *workflow.ContinueAsNewError
+		if !errors.As(env.GetWorkflowError(), &canErr) {
+			break
+		}
+		var carried, seen []int
+		var totalArg, batchSizeArg, maxPerRunArg int
+		require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(canErr.Input,
+			&totalArg, &batchSizeArg, &maxPerRunArg, &carried, &seen))
+		require.Len(t, carried, total-len(seen), "messages lost or duplicated on continue-as-new")
+
+		env = testSuite.NewTestWorkflowEnvironment()
+		env.ExecuteWorkflow(orderingWorkflow, totalArg, batchSizeArg, maxPerRunArg, carried, seen)
+		runs++
+	}
+	require.NoError(t, env.GetWorkflowError())
+	require.Greater(t, runs, 1)
+
+	var seen []int
+	require.NoError(t, env.GetWorkflowResult(&seen))
+	require.Len(t, seen, total)
+	for i, msg := range seen {
+		require.Equal(t, i, msg)
+	}
+}
@@ -2,26 +2,45 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
-)
 
-var (
-	c          client.Client
-	workflowID = uuid.New().String()
-	taskQueue  = "my-task-queue" + uuid.New().String()
+	"github.com/taonic/my-samples-go/fifo_signals/fifo"
 )
 
 const (
 	signalName = "my-signal"
+
+	// blockedKeysQueryName query name returning the blocked keys and their failures
+	blockedKeysQueryName = "blocked-keys"
+	// unblockKeyUpdateName update name for retrying the failed message of a blocked key
+	unblockKeyUpdateName = "unblock-key"
+	// submitUpdateName update name for sending a message and confirming it was accepted
+	submitUpdateName = "submit"
+	// messageStatusQueryName query name returning the fifo.MessageStatus of a message ID
+	messageStatusQueryName = "message-status"
+	// deadLettersQueryName query name returning the dead-lettered messages
+	deadLettersQueryName = "dead-letters"
+	// replayDeadLettersSignalName channel name for replaying dead-lettered messages
+	replayDeadLettersSignalName = "replay-dead-letters"
+
+	// queueFullErrorType is the ApplicationError type of a message rejected
+	// because FifoConfig.MaxBuffered messages are waiting.
+	queueFullErrorType = "QueueFull"
+
+	// dedupWindowSize is the number of message IDs remembered to drop resent messages.
+	dedupWindowSize = 1000
 )
 
 func main() {
@@ -33,9 +52,11 @@ func main() {
 func run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	var err error
 
-	c, err = client.Dial(client.Options{})
+	workflowID := uuid.New().String()
+	taskQueue := "my-task-queue" + uuid.New().String()
+
+	c, err := client.Dial(client.Options{})
 	if err != nil {
 		return err
 	}
@@ -50,33 +71,32 @@ func run() error {
 	}
 	defer w.Stop()
 
-	// Run workflows
-	wo := client.StartWorkflowOptions{
-		TaskQueue: taskQueue,
+	config := FifoConfig{
+		Concurrency:      10,
+		MaxHistoryLength: 2000,
+		MaxBuffered:      50,
+		Retry: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    10 * time.Second,
+			MaximumAttempts:    5,
+		},
 	}
-	var run client.WorkflowRun
+	producer := NewProducer(c, workflowID, taskQueue, config)
 
-	concurrency := 10
-	maxMessages := 100
-	// Send concurrent signals in batches
+	// Send concurrent messages in batches, slowing down while the queue is full
 	for j := 0; j < 20; j++ {
 		var wg sync.WaitGroup
 		for i := 0; i < 20; i++ {
 			wg.Add(1)
-			myCounter := j*10 + i
+			myCounter := j*20 + i
 			go func() {
 				defer wg.Done()
-				run, err = c.SignalWithStartWorkflow(
-					ctx,
-					workflowID,
-					signalName,
-					fmt.Sprintf("belated message %d", myCounter),
-					wo,
-					FifoWorkflow,
-					concurrency,
-					maxMessages,
-					[]string{},
-				)
+				_, err := producer.Send(ctx, Message{
+					ID:   fmt.Sprintf("message-%d", myCounter),
+					Key:  fmt.Sprintf("key-%d", myCounter%5),
+					Body: fmt.Sprintf("belated message %d", myCounter),
+				})
 				if err != nil {
 					panic(err)
 				}
@@ -86,7 +106,15 @@ func run() error {
 		time.Sleep(1 * time.Second)
 	}
 
-	err = run.Get(context.Background(), nil)
+	// Resending a message, e.g. after a client retry, is acknowledged without
+	// processing it again.
+	status, err := producer.Send(ctx, Message{ID: "message-0", Key: "key-0", Body: "belated message 0"})
+	if err != nil {
+		return err
+	}
+	log.Println("message-0 resent, status:", status)
+
+	err = c.GetWorkflow(ctx, workflowID, "").Get(context.Background(), nil)
 	if err != nil {
 		return err
 	}
@@ -94,81 +122,251 @@ func run() error {
 	return nil
 }
 
-type Listener struct {
-	Messages []string
-	Max      int
-	Done     bool
+// Message is the payload of signalName. Messages with the same Key are
+// processed one at a time in the order they were received.
+//
+// ID identifies the message for deduplication and acknowledgement. Producers
+// retrying a send must reuse the ID. Messages without an ID are not deduplicated.
+type Message struct {
+	ID   string
+	Key  string
+	Body string
 }
 
-func (l *Listener) Listen(ctx workflow.Context) {
-	chn := workflow.GetSignalChannel(ctx, signalName)
-	processed := 0
-	selector := workflow.NewSelector(ctx)
-	selector.AddReceive(chn, func(c workflow.ReceiveChannel, more bool) {
-		var msg string
-		c.Receive(ctx, &msg)
-		processed++
-		l.Messages = append(l.Messages, msg)
-	})
+// FifoConfig configures FifoWorkflow.
+type FifoConfig struct {
+	// Concurrency is the number of keys processed in parallel, at least 1.
+	Concurrency int
+	// MaxHistoryLength continues as new once the history has more events,
+	// besides when the server suggests it. 0 relies on the suggestion only.
+	MaxHistoryLength int
+	// Retry is the retry budget of each message. The default makes 3 attempts.
+	Retry *temporal.RetryPolicy
+	// MaxBuffered bounds the messages waiting to be processed: beyond it,
+	// submitUpdateName rejects new messages with queueFullErrorType. Signals
+	// cannot be rejected and are always queued. 0 means unbounded.
+	MaxBuffered int
+	// BlockOnFailure blocks the key of a message that failed every attempt
+	// instead of dead-lettering the message, for keys whose messages must
+	// never be skipped. See unblockKeyUpdateName.
+	BlockOnFailure bool
+}
 
-	for {
-		if processed > l.Max && chn.Len() == 0 {
-			l.Done = true
-			return
-		}
+// FifoState is carried over to the next run on continue-as-new.
+type FifoState struct {
+	// Messages not processed yet, in arrival order.
+	Messages []Message
+	// Blocked maps the keys blocked by a failed message to the failure.
+	Blocked map[string]string
+	// Dedup holds the recently seen message IDs.
+	Dedup []fifo.DedupEntry
+	// DeadLetters holds the messages that failed every attempt.
+	DeadLetters []fifo.DeadLetter[Message]
+}
 
-		selector.Select(ctx)
-	}
+// ReplayRequest is the payload of replayDeadLettersSignalName.
+type ReplayRequest struct {
+	// IDs selects the dead letters to replay, all of them if empty.
+	IDs []string
 }
 
-func Activity(ctx context.Context, name string) (string, error) {
+func Activity(ctx context.Context, msg Message) (string, error) {
 	logger := activity.GetLogger(ctx)
-	logger.Info("Hello", "name", name)
-	return "Hello " + name + "!", nil
+	logger.Info("Hello", "key", msg.Key, "name", msg.Body)
+	return "Hello " + msg.Body + "!", nil
 }
 
-func FifoWorkflow(ctx workflow.Context, concurrency int, maxMessages int, messages []string) (string, error) {
+// FifoWorkflow processes the messages of each key in order, running up to
+// config.Concurrency keys in parallel. A message is retried with backoff
+// within config.Retry; once that budget is spent, the message is dead-lettered
+// and the next message of its key is processed.
+func FifoWorkflow(ctx workflow.Context, config FifoConfig, state *FifoState) (string, error) {
 	logger := workflow.GetLogger(ctx)
-	l := Listener{
-		Messages: messages,
-		Max:      maxMessages,
+	if state == nil {
+		state = &FifoState{}
+	}
+	retryPolicy := config.Retry
+	if retryPolicy == nil {
+		retryPolicy = &temporal.RetryPolicy{MaximumAttempts: 3}
 	}
-	workflow.Go(ctx, l.Listen)
+	window := fifo.NewDedupWindow(dedupWindowSize, state.Dedup)
+	deadLetters := fifo.NewDeadLetterQueue(state.DeadLetters)
 
-	for {
-		// Wait for listener to populate messages
-		err := workflow.Await(ctx, func() bool {
-			return len(l.Messages) > 0
+	dispatcher := fifo.NewKeyedDispatcher(config.Concurrency,
+		func(msg Message) string { return msg.Key },
+		func(ctx workflow.Context, msg Message) error {
+			ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+				StartToCloseTimeout: time.Second * 5,
+				RetryPolicy:         retryPolicy,
+			})
+			var result string
+			err := workflow.ExecuteActivity(ctx, Activity, msg).Get(ctx, &result)
+			if err != nil && config.BlockOnFailure {
+				return err
+			}
+			if err != nil {
+				logger.Error("Dead-lettering message", "id", msg.ID, "key", msg.Key, "Error", err)
+				deadLetters.Add(msg, err, workflow.Now(ctx))
+				window.Mark(msg.ID, fifo.StatusDeadLettered)
+				return nil
+			}
+			logger.Info("Result", "key", msg.Key, "result", result)
+			window.Mark(msg.ID, fifo.StatusProcessed)
+			return nil
 		})
-		if err != nil {
-			return "", err
-		}
+	for key, reason := range state.Blocked {
+		dispatcher.Block(key, reason)
+	}
+	dispatcher.Add(ctx, state.Messages...)
 
-		// Execute activities concurrently
-		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
-			StartToCloseTimeout: time.Second * 5,
+	if err := workflow.SetQueryHandler(ctx, blockedKeysQueryName, func() (map[string]string, error) {
+		return dispatcher.Blocked(), nil
+	}); err != nil {
+		return "", err
+	}
+	if err := workflow.SetUpdateHandlerWithOptions(ctx, unblockKeyUpdateName,
+		func(ctx workflow.Context, key string) error {
+			dispatcher.Unblock(ctx, key)
+			return nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, key string) error {
+				if _, ok := dispatcher.Blocked()[key]; !ok {
+					return fmt.Errorf("key %q is not blocked", key)
+				}
+				return nil
+			},
+		}); err != nil {
+		return "", err
+	}
+	if err := workflow.SetQueryHandler(ctx, deadLettersQueryName, func() ([]fifo.DeadLetter[Message], error) {
+		return deadLetters.List(), nil
+	}); err != nil {
+		return "", err
+	}
+
+	// Replayed messages are queued behind the pending messages of their key.
+	replayCh := workflow.GetSignalChannel(ctx, replayDeadLettersSignalName)
+	replay := func(ctx workflow.Context, request ReplayRequest) {
+		msgs := deadLetters.Remove(func(msg Message) bool {
+			return len(request.IDs) == 0 || slices.Contains(request.IDs, msg.ID)
 		})
-		futures := []workflow.Future{}
-		for len(l.Messages) > 0 && len(futures) < concurrency {
-			var msg string
-			msg, l.Messages = l.Messages[0], l.Messages[1:]
-			f := workflow.ExecuteActivity(ctx, Activity, msg)
-			futures = append(futures, f)
+		for _, msg := range msgs {
+			window.Mark(msg.ID, fifo.StatusAccepted)
+		}
+		logger.Info("Replaying dead letters", "count", len(msgs))
+		dispatcher.Add(ctx, msgs...)
+	}
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		for {
+			var request ReplayRequest
+			replayCh.Receive(ctx, &request)
+			replay(ctx, request)
 		}
+	})
 
-		// Wait for the concurrent batch to complete
-		for _, f := range futures {
-			var result string
-			err := f.Get(ctx, &result)
-			if err != nil {
-				return "", err
-			}
-			logger.Info("Result", result)
+	queue := fifo.NewSignalQueue[Message](ctx, signalName, nil)
+	buffered := func() int { return dispatcher.Len() + queue.Len() }
+	// submitted holds the IDs accepted by the submit update that are still
+	// queued. The window has them already, so they pass the dedup check once.
+	submitted := make(map[string]bool)
+	if err := registerAckHandlers(ctx, queue, window, submitted, config.MaxBuffered, buffered); err != nil {
+		return "", err
+	}
+	shouldContinueAsNew := func() bool {
+		info := workflow.GetInfo(ctx)
+		return info.GetContinueAsNewSuggested() ||
+			(config.MaxHistoryLength > 0 && info.GetCurrentHistoryLength() > config.MaxHistoryLength)
+	}
+	accept := func(msg Message) bool {
+		if submitted[msg.ID] {
+			delete(submitted, msg.ID)
+			return true
+		}
+		if !window.Accept(msg.ID) {
+			logger.Info("Dropping duplicate message", "id", msg.ID)
+			return false
+		}
+		return true
+	}
+	for !shouldContinueAsNew() {
+		err := workflow.Await(ctx, func() bool { return queue.Len() > 0 || shouldContinueAsNew() })
+		if err != nil {
+			return "", err
+		}
+		if queue.Len() == 0 {
+			continue
+		}
+		msg, err := queue.Next(ctx)
+		if err != nil {
+			return "", err
 		}
+		if accept(msg) {
+			dispatcher.Add(ctx, msg)
+		}
+	}
 
-		// Continue as new if needed
-		if l.Done {
-			return "", workflow.NewContinueAsNewError(ctx, FifoWorkflow, concurrency, maxMessages, l.Messages)
+	// Let the running messages and handlers finish, then carry everything
+	// else over, including the signals received in the meantime.
+	dispatcher.Stop()
+	err := workflow.Await(ctx, func() bool {
+		return dispatcher.Running() == 0 && workflow.AllHandlersFinished(ctx)
+	})
+	if err != nil {
+		return "", err
+	}
+	var request ReplayRequest
+	for replayCh.ReceiveAsync(&request) {
+		replay(ctx, request)
+	}
+	next := &FifoState{
+		Messages:    dispatcher.Pending(),
+		Blocked:     dispatcher.Blocked(),
+		DeadLetters: deadLetters.List(),
+	}
+	for _, msg := range queue.Drain() {
+		if accept(msg) {
+			next.Messages = append(next.Messages, msg)
 		}
 	}
+	next.Dedup = window.Entries()
+	logger.Info("Continuing as new", "messages", len(next.Messages))
+	return "", workflow.NewContinueAsNewError(ctx, FifoWorkflow, config, next)
+}
+
+// registerAckHandlers lets producers confirm that a message was durably
+// accepted, by sending it through the submitUpdateName update, and processed,
+// by querying its status. An accepted message is recorded in window and
+// submitted right away, so that its status and resends are answered before it
+// is dequeued. New messages are rejected with queueFullErrorType while more
+// than maxBuffered messages are waiting, unless maxBuffered is 0.
+func registerAckHandlers(ctx workflow.Context, queue *fifo.SignalQueue[Message], window *fifo.DedupWindow,
+	submitted map[string]bool, maxBuffered int, buffered func() int) error {
+	if err := workflow.SetQueryHandler(ctx, messageStatusQueryName, func(id string) (fifo.MessageStatus, error) {
+		return window.Status(id), nil
+	}); err != nil {
+		return err
+	}
+	return workflow.SetUpdateHandlerWithOptions(ctx, submitUpdateName,
+		func(ctx workflow.Context, msg Message) (fifo.MessageStatus, error) {
+			if !window.Accept(msg.ID) {
+				return window.Status(msg.ID), nil
+			}
+			submitted[msg.ID] = true
+			queue.Push(msg)
+			return fifo.StatusAccepted, nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, msg Message) error {
+				if msg.ID == "" {
+					return errors.New("message ID is required")
+				}
+				// Resent messages are acknowledged even when the queue is full.
+				if maxBuffered > 0 && buffered() >= maxBuffered && window.Status(msg.ID) == fifo.StatusUnknown {
+					return temporal.NewApplicationError(
+						fmt.Sprintf("%d messages are waiting, slow down", buffered()), queueFullErrorType)
+				}
+				return nil
+			},
+		})
 }
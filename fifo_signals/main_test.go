@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/taonic/my-samples-go/fifo_signals/fifo"
+)
+
+func Test_FifoWorkflow_DeadLetters(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	fixed := false
+	var processed []string
+	env.OnActivity(Activity, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, msg Message) (string, error) {
+			if msg.ID == "poison" && !fixed {
+				return "", errors.New("cannot process message")
+			}
+			processed = append(processed, msg.ID)
+			return "", nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		for _, id := range []string{"1", "poison", "2", "3"} {
+			env.SignalWorkflow(signalName, Message{ID: id, Key: "key", Body: id})
+		}
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		// The poison message spent its budget without holding up its key.
+		require.Equal(t, []string{"1", "2", "3"}, processed)
+		result, err := env.QueryWorkflow(deadLettersQueryName)
+		require.NoError(t, err)
+		var deadLetters []fifo.DeadLetter[Message]
+		require.NoError(t, result.Get(&deadLetters))
+		require.Len(t, deadLetters, 1)
+		require.Equal(t, "poison", deadLetters[0].Message.ID)
+		require.Equal(t, fifo.StatusDeadLettered, queryStatus(t, env, "poison"))
+
+		fixed = true
+		env.SignalWorkflow(replayDeadLettersSignalName, ReplayRequest{})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		require.Equal(t, []string{"1", "2", "3", "poison"}, processed)
+		require.Equal(t, fifo.StatusProcessed, queryStatus(t, env, "poison"))
+		env.CancelWorkflow()
+	}, 2*time.Minute)
+
+	env.ExecuteWorkflow(FifoWorkflow, FifoConfig{
+		Concurrency: 2,
+		Retry: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2,
+			MaximumAttempts:    4,
+		},
+	}, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var canceledErr *temporal.CanceledError
+	require.ErrorAs(t, env.GetWorkflowError(), &canceledErr)
+}
+
+func queryStatus(t *testing.T, env *testsuite.TestWorkflowEnvironment, id string) fifo.MessageStatus {
+	result, err := env.QueryWorkflow(messageStatusQueryName, id)
+	require.NoError(t, err)
+	var status fifo.MessageStatus
+	require.NoError(t, result.Get(&status))
+	return status
+}
+
+func Test_FifoWorkflow_RejectsWhenFull(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.OnActivity(Activity, mock.Anything, mock.Anything).After(time.Minute).Return("", nil)
+
+	type outcome struct {
+		status fifo.MessageStatus
+		err    error
+	}
+	outcomes := make(map[string]outcome)
+	submit := func(updateID, messageID string) {
+		env.UpdateWorkflow(submitUpdateName, updateID, &testsuite.TestUpdateCallback{
+			OnAccept: func() {},
+			OnReject: func(err error) { outcomes[updateID] = outcome{err: err} },
+			OnComplete: func(result interface{}, err error) {
+				status, _ := result.(fifo.MessageStatus)
+				outcomes[updateID] = outcome{status: status, err: err}
+			},
+		}, Message{ID: messageID, Key: "key", Body: messageID})
+	}
+
+	// Message 1 is being processed and message 2 is waiting when message 3 arrives.
+	env.RegisterDelayedCallback(func() { submit("first-1", "1") }, time.Second)
+	env.RegisterDelayedCallback(func() { submit("first-2", "2") }, 2*time.Second)
+	env.RegisterDelayedCallback(func() {
+		submit("first-3", "3")
+		submit("resent-1", "1")
+	}, 3*time.Second)
+	env.RegisterDelayedCallback(func() { submit("second-3", "3") }, 90*time.Second)
+	env.RegisterDelayedCallback(env.CancelWorkflow, 91*time.Second)
+
+	env.ExecuteWorkflow(FifoWorkflow, FifoConfig{Concurrency: 1, MaxBuffered: 2}, nil)
+	require.True(t, env.IsWorkflowCompleted())
+
+	for _, updateID := range []string{"first-1", "first-2", "second-3"} {
+		require.NoError(t, outcomes[updateID].err, updateID)
+		require.Equal(t, fifo.StatusAccepted, outcomes[updateID].status, updateID)
+	}
+	var appErr *temporal.ApplicationError
+	require.ErrorAs(t, outcomes["first-3"].err, &appErr)
+	require.Equal(t, queueFullErrorType, appErr.Type())
+
+	// A resent message is acknowledged rather than rejected; by the time message
+	// 3 is sent again, message 1 has been processed and made room for it.
+	require.NoError(t, outcomes["resent-1"].err)
+	require.Equal(t, fifo.StatusAccepted, outcomes["resent-1"].status)
+}
+
+func Test_FifoWorkflow_AcknowledgesSubmittedMessagesOnce(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.OnActivity(Activity, mock.Anything, mock.Anything).After(time.Minute).Return("", nil)
+
+	outcomes := make(map[string]error)
+	statuses := make(map[string]fifo.MessageStatus)
+	submit := func(updateID, messageID string) {
+		env.UpdateWorkflow(submitUpdateName, updateID, &testsuite.TestUpdateCallback{
+			OnAccept: func() {},
+			OnReject: func(err error) { outcomes[updateID] = err },
+			OnComplete: func(result interface{}, err error) {
+				statuses[updateID], _ = result.(fifo.MessageStatus)
+				outcomes[updateID] = err
+			},
+		}, Message{ID: messageID, Key: "key", Body: messageID})
+	}
+
+	// Message 1 is being processed when continue-as-new is suggested, so the
+	// messages submitted until it completes stay queued.
+	env.RegisterDelayedCallback(func() { submit("first-1", "1") }, time.Second)
+	env.RegisterDelayedCallback(func() { env.SetContinueAsNewSuggested(true) }, 2*time.Second)
+	env.RegisterDelayedCallback(func() { submit("first-2", "2") }, 3*time.Second)
+	env.RegisterDelayedCallback(func() {
+		// Message 2 is acknowledged as soon as the update completes.
+		require.Equal(t, fifo.StatusAccepted, queryStatus(t, env, "2"))
+		// The queue is full, yet resending message 2 is acknowledged.
+		submit("resent-2", "2")
+		submit("first-3", "3")
+	}, 4*time.Second)
+	env.ExecuteWorkflow(FifoWorkflow, FifoConfig{Concurrency: 1, MaxBuffered: 2}, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	for _, updateID := range []string{"first-1", "first-2", "resent-2"} {
+		require.NoError(t, outcomes[updateID], updateID)
+		require.Equal(t, fifo.StatusAccepted, statuses[updateID], updateID)
+	}
+	var appErr *temporal.ApplicationError
+	require.ErrorAs(t, outcomes["first-3"], &appErr)
+	require.Equal(t, queueFullErrorType, appErr.Type())
+
+	// Message 2 is carried over once, and remembered as accepted.
+	var canErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, env.GetWorkflowError(), &canErr)
+	var config FifoConfig
+	var state *FifoState
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(canErr.Input, &config, &state))
+	require.Equal(t, []Message{{ID: "2", Key: "key", Body: "2"}}, state.Messages)
+	require.Contains(t, state.Dedup, fifo.DedupEntry{ID: "2", Status: fifo.StatusAccepted})
+	require.Contains(t, state.Dedup, fifo.DedupEntry{ID: "1", Status: fifo.StatusProcessed})
+}
+
+func Test_FifoWorkflow_ContinueAsNewLosesNothing(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	config := FifoConfig{Concurrency: 2}
+	message := func(i int) Message {
+		id := fmt.Sprintf("m%d", i)
+		return Message{ID: id, Key: fmt.Sprintf("key-%d", i%3), Body: id}
+	}
+	// Activities run on their own goroutines.
+	var mu sync.Mutex
+	var processed []Message
+	mockActivity := func(env *testsuite.TestWorkflowEnvironment) {
+		env.OnActivity(Activity, mock.Anything, mock.Anything).After(5 * time.Second).Return(
+			func(ctx context.Context, msg Message) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				processed = append(processed, msg)
+				return "", nil
+			})
+	}
+	processedMessages := func() []Message {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(processed)
+	}
+
+	// First run: continue-as-new is suggested while messages are in flight and
+	// more signals, including a duplicate, are buffered in the same task.
+	env := testSuite.NewTestWorkflowEnvironment()
+	mockActivity(env)
+	env.RegisterDelayedCallback(func() {
+		for i := 0; i < 10; i++ {
+			env.SignalWorkflow(signalName, message(i))
+		}
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SetContinueAsNewSuggested(true)
+		for i := 10; i < 20; i++ {
+			env.SignalWorkflowSkippingWorkflowTask(signalName, message(i))
+		}
+		env.SignalWorkflowSkippingWorkflowTask(signalName, message(5))
+		env.SignalWorkflow(signalName, message(20))
+	}, 7*time.Second)
+	env.ExecuteWorkflow(FifoWorkflow, config, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var canErr *workflow.ContinueAsNewError
+	require.ErrorAs(t, env.GetWorkflowError(), &canErr)
+	var nextConfig FifoConfig
+	var state *FifoState
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(canErr.Input, &nextConfig, &state))
+	require.NotEmpty(t, state.Messages)
+	require.Len(t, processedMessages(), 21-len(state.Messages))
+
+	// Second run: the carried messages are processed before new ones, and
+	// messages resent by producers across the boundary are dropped.
+	env = testSuite.NewTestWorkflowEnvironment()
+	mockActivity(env)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(signalName, message(0))
+		env.SignalWorkflow(signalName, message(15))
+		env.SignalWorkflow(signalName, message(21))
+	}, time.Second)
+	env.RegisterDelayedCallback(env.CancelWorkflow, 10*time.Minute)
+	env.ExecuteWorkflow(FifoWorkflow, nextConfig, state)
+	require.True(t, env.IsWorkflowCompleted())
+
+	seen := make(map[string]int)
+	lastByKey := make(map[string]int)
+	for _, msg := range processedMessages() {
+		seen[msg.ID]++
+		var i int
+		_, err := fmt.Sscanf(msg.ID, "m%d", &i)
+		require.NoError(t, err)
+		if last, ok := lastByKey[msg.Key]; ok {
+			require.Greater(t, i, last, "%s processed out of order", msg.Key)
+		}
+		lastByKey[msg.Key] = i
+	}
+	require.Len(t, seen, 22)
+	for id, count := range seen {
+		require.Equal(t, 1, count, "%s processed more than once", id)
+	}
+}
+
+// Test_FifoWorkflow_Replay replays a run that continued as new, and the run it
+// continued as, recorded from a dev server. Unlike the test environment, it
+// fails on changes that are not deterministic across continue-as-new. After an
+// intentional incompatible change, record them again with
+// `temporal workflow show --workflow-id <id> --run-id <run> --output json`.
+func Test_FifoWorkflow_Replay(t *testing.T) {
+	replayer := worker.NewWorkflowReplayer()
+	replayer.RegisterWorkflow(FifoWorkflow)
+	for _, file := range []string{"fifo_first_run.json", "fifo_continued_run.json"} {
+		require.NoError(t, replayer.ReplayWorkflowHistoryFromJSONFile(nil, file), file)
+	}
+}
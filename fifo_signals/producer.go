@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/taonic/my-samples-go/fifo_signals/fifo"
+)
+
+const (
+	producerInitialBackoff = 100 * time.Millisecond
+	producerMaximumBackoff = 5 * time.Second
+	producerMaximumRetries = 20
+)
+
+// Producer submits messages to a FifoWorkflow, starting it if it is not
+// running, and backs off while the workflow reports that its queue is full.
+type Producer struct {
+	client     client.Client
+	workflowID string
+	taskQueue  string
+	config     FifoConfig
+}
+
+// NewProducer creates a producer for the FifoWorkflow workflowID, which is
+// started on taskQueue with config if it is not running.
+func NewProducer(c client.Client, workflowID, taskQueue string, config FifoConfig) *Producer {
+	return &Producer{
+		client:     c,
+		workflowID: workflowID,
+		taskQueue:  taskQueue,
+		config:     config,
+	}
+}
+
+// Send submits msg and returns once the workflow durably accepted it. A
+// message rejected because the queue is full is resent with exponential
+// backoff; since msg.ID stays the same, it is processed at most once.
+func (p *Producer) Send(ctx context.Context, msg Message) (fifo.MessageStatus, error) {
+	backoff := producerInitialBackoff
+	for attempt := 1; ; attempt++ {
+		status, err := p.submit(ctx, msg)
+		var appErr *temporal.ApplicationError
+		if err == nil || !errors.As(err, &appErr) || appErr.Type() != queueFullErrorType ||
+			attempt == producerMaximumRetries {
+			return status, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, producerMaximumBackoff)
+	}
+}
+
+func (p *Producer) submit(ctx context.Context, msg Message) (fifo.MessageStatus, error) {
+	startOperation := p.client.NewWithStartWorkflowOperation(client.StartWorkflowOptions{
+		ID:                       p.workflowID,
+		TaskQueue:                p.taskQueue,
+		WorkflowIDConflictPolicy: enumspb.WORKFLOW_ID_CONFLICT_POLICY_USE_EXISTING,
+	}, FifoWorkflow, p.config, nil)
+	handle, err := p.client.UpdateWithStartWorkflow(ctx, client.UpdateWithStartWorkflowOptions{
+		StartWorkflowOperation: startOperation,
+		UpdateOptions: client.UpdateWorkflowOptions{
+			UpdateName:   submitUpdateName,
+			Args:         []interface{}{msg},
+			WaitForStage: client.WorkflowUpdateStageCompleted,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	var status fifo.MessageStatus
+	err = handle.Get(ctx, &status)
+	return status, err
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/operatorservice/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Status is the outcome of a check, ordered by severity.
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarn
+	StatusCrit
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusWarn:
+		return "WARN"
+	default:
+		return "CRIT"
+	}
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ExitCode is the Nagios plugin exit code of the status.
+func (s Status) ExitCode() int {
+	return int(s)
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name    string                 `json:"name"`
+	Status  Status                 `json:"status"`
+	Message string                 `json:"message"`
+	Latency string                 `json:"latency,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the outcome of all checks, with the status of the worst of them.
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+func newReport(results []Result) Report {
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status > report.Status {
+			report.Status = result.Status
+		}
+	}
+	return report
+}
+
+// ProbeOptions configure the checks beyond the server and namespace ones.
+type ProbeOptions struct {
+	// TaskQueues must each have workflow and activity pollers.
+	TaskQueues []string
+	// MinRetention warns about namespaces retaining closed workflows for less.
+	MinRetention time.Duration
+	// SearchAttributes must be registered on the namespace.
+	SearchAttributes []string
+	// ClockSkewWarn and ClockSkewCrit bound the difference between the local
+	// and the server clock.
+	ClockSkewWarn time.Duration
+	ClockSkewCrit time.Duration
+	// Timeout bounds each check.
+	Timeout time.Duration
+}
+
+// Prober runs the checks against a Temporal namespace.
+type Prober struct {
+	Client    client.Client
+	Namespace string
+	Options   ProbeOptions
+}
+
+// Run runs all checks, each whether or not the previous ones passed.
+func (p *Prober) Run(ctx context.Context) Report {
+	results := []Result{p.timed(ctx, "server", p.checkServer)}
+	results = append(results, p.checkNamespace(ctx)...)
+	for _, taskQueue := range p.Options.TaskQueues {
+		taskQueue := taskQueue
+		results = append(results, p.timed(ctx, "task_queue:"+taskQueue, func(ctx context.Context) Result {
+			return p.checkTaskQueue(ctx, taskQueue)
+		}))
+	}
+	if len(p.Options.SearchAttributes) > 0 {
+		results = append(results, p.timed(ctx, "search_attributes", p.checkSearchAttributes))
+	}
+	return newReport(results)
+}
+
+// timed runs check within the timeout and records its latency.
+func (p *Prober) timed(ctx context.Context, name string, check func(context.Context) Result) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.Options.Timeout)
+	defer cancel()
+	start := time.Now()
+	result := check(ctx)
+	result.Name = name
+	result.Latency = time.Since(start).Round(time.Millisecond).String()
+	return result
+}
+
+func (p *Prober) checkServer(ctx context.Context) Result {
+	if _, err := p.Client.CheckHealth(ctx, &client.CheckHealthRequest{}); err != nil {
+		return Result{Status: StatusCrit, Message: fmt.Sprintf("health check failed: %v", err)}
+	}
+	return Result{Status: StatusOK, Message: "serving"}
+}
+
+// checkNamespace describes the namespace, and estimates the clock skew from
+// the Date header of the response, which proxies such as the one in front of
+// Temporal Cloud set.
+func (p *Prober) checkNamespace(ctx context.Context) []Result {
+	var header metadata.MD
+	var describe *workflowservice.DescribeNamespaceResponse
+	var sent, received time.Time
+	namespace := p.timed(ctx, "namespace", func(ctx context.Context) Result {
+		var err error
+		sent = time.Now()
+		describe, err = p.Client.WorkflowService().DescribeNamespace(ctx,
+			&workflowservice.DescribeNamespaceRequest{Namespace: p.Namespace},
+			grpc.Header(&header))
+		received = time.Now()
+		if err != nil {
+			return Result{Status: StatusCrit, Message: fmt.Sprintf("failed to describe namespace %s: %v", p.Namespace, err)}
+		}
+		return evaluateNamespace(describe, p.Options.MinRetention)
+	})
+	if describe == nil {
+		return []Result{namespace}
+	}
+
+	// The server time lies between sending and receiving.
+	local := sent.Add(received.Sub(sent) / 2)
+	return []Result{namespace, evaluateServerTime(header.Get("date"), local, p.Options.ClockSkewWarn, p.Options.ClockSkewCrit)}
+}
+
+func (p *Prober) checkTaskQueue(ctx context.Context, taskQueue string) Result {
+	workflow, err := p.Client.DescribeTaskQueue(ctx, taskQueue, enumspb.TASK_QUEUE_TYPE_WORKFLOW)
+	if err != nil {
+		return Result{Status: StatusCrit, Message: fmt.Sprintf("failed to describe task queue %s: %v", taskQueue, err)}
+	}
+	activity, err := p.Client.DescribeTaskQueue(ctx, taskQueue, enumspb.TASK_QUEUE_TYPE_ACTIVITY)
+	if err != nil {
+		return Result{Status: StatusCrit, Message: fmt.Sprintf("failed to describe task queue %s: %v", taskQueue, err)}
+	}
+	return evaluateTaskQueue(workflow, activity)
+}
+
+func (p *Prober) checkSearchAttributes(ctx context.Context) Result {
+	list, err := p.Client.OperatorService().ListSearchAttributes(ctx,
+		&operatorservice.ListSearchAttributesRequest{Namespace: p.Namespace})
+	if err != nil {
+		return Result{Status: StatusCrit, Message: fmt.Sprintf("failed to list search attributes: %v", err)}
+	}
+	return evaluateSearchAttributes(list, p.Options.SearchAttributes)
+}
+
+// evaluateNamespace is critical for namespaces that are not registered, and
+// warns about a retention shorter than minRetention.
+func evaluateNamespace(describe *workflowservice.DescribeNamespaceResponse, minRetention time.Duration) Result {
+	state := describe.GetNamespaceInfo().GetState()
+	retention := describe.GetConfig().GetWorkflowExecutionRetentionTtl().AsDuration()
+	details := map[string]interface{}{
+		"id":        describe.GetNamespaceInfo().GetId(),
+		"state":     state.String(),
+		"retention": retention.String(),
+	}
+	if state != enumspb.NAMESPACE_STATE_REGISTERED {
+		return Result{Status: StatusCrit, Message: fmt.Sprintf("namespace is %s", state), Details: details}
+	}
+	if minRetention > 0 && retention < minRetention {
+		return Result{
+			Status:  StatusWarn,
+			Message: fmt.Sprintf("retention %s is below %s", retention, minRetention),
+			Details: details,
+		}
+	}
+	return Result{Status: StatusOK, Message: "registered", Details: details}
+}
+
+// evaluateTaskQueue is critical for task queues nobody polls, and warns
+// about task queues polled for only workflow or only activity tasks.
+func evaluateTaskQueue(workflow, activity *workflowservice.DescribeTaskQueueResponse) Result {
+	details := map[string]interface{}{
+		"workflowPollers": pollerIdentities(workflow),
+		"activityPollers": pollerIdentities(activity),
+	}
+	workflowPollers, activityPollers := len(workflow.GetPollers()), len(activity.GetPollers())
+	switch {
+	case workflowPollers == 0 && activityPollers == 0:
+		return Result{Status: StatusCrit, Message: "no pollers", Details: details}
+	case workflowPollers == 0:
+		return Result{Status: StatusWarn, Message: "no workflow pollers", Details: details}
+	case activityPollers == 0:
+		return Result{Status: StatusWarn, Message: "no activity pollers", Details: details}
+	}
+	return Result{
+		Status:  StatusOK,
+		Message: fmt.Sprintf("%d workflow and %d activity pollers", workflowPollers, activityPollers),
+		Details: details,
+	}
+}
+
+func pollerIdentities(describe *workflowservice.DescribeTaskQueueResponse) []string {
+	identities := []string{}
+	for _, poller := range describe.GetPollers() {
+		identities = append(identities, poller.GetIdentity())
+	}
+	sort.Strings(identities)
+	return identities
+}
+
+// evaluateSearchAttributes is critical if any of the required search
+// attributes is not registered.
+func evaluateSearchAttributes(list *operatorservice.ListSearchAttributesResponse, required []string) Result {
+	var missing []string
+	for _, name := range required {
+		if _, ok := list.GetCustomAttributes()[name]; ok {
+			continue
+		}
+		if _, ok := list.GetSystemAttributes()[name]; ok {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) > 0 {
+		return Result{
+			Status:  StatusCrit,
+			Message: "missing search attributes: " + strings.Join(missing, ", "),
+			Details: map[string]interface{}{"missing": missing},
+		}
+	}
+	return Result{Status: StatusOK, Message: fmt.Sprintf("%d search attributes registered", len(required))}
+}
+
+// evaluateServerTime evaluates the clock skew between local and the server
+// time in the Date header values. Without a valid server time the skew is
+// unknown, which warns rather than passes.
+func evaluateServerTime(dates []string, local time.Time, warn, crit time.Duration) Result {
+	if len(dates) == 0 {
+		return Result{Name: "clock_skew", Status: StatusWarn, Message: "server time not reported, clock skew unknown"}
+	}
+	serverTime, err := http.ParseTime(dates[0])
+	if err != nil {
+		return Result{Name: "clock_skew", Status: StatusWarn,
+			Message: fmt.Sprintf("invalid server time %q, clock skew unknown", dates[0])}
+	}
+	return evaluateClockSkew(serverTime.Sub(local), warn, crit)
+}
+
+// evaluateClockSkew grades the difference between the server and the local
+// clock. The Date header has a resolution of a second, so skew below that is
+// not meaningful.
+func evaluateClockSkew(skew, warn, crit time.Duration) Result {
+	details := map[string]interface{}{"skew": skew.Round(time.Millisecond).String()}
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case crit > 0 && abs >= crit:
+		return Result{Name: "clock_skew", Status: StatusCrit, Message: fmt.Sprintf("clock skew %s exceeds %s", skew, crit), Details: details}
+	case warn > 0 && abs >= warn:
+		return Result{Name: "clock_skew", Status: StatusWarn, Message: fmt.Sprintf("clock skew %s exceeds %s", skew, warn), Details: details}
+	}
+	return Result{Name: "clock_skew", Status: StatusOK, Message: "clock in sync", Details: details}
+}
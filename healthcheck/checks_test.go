@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	enumspb "go.temporal.io/api/enums/v1"
+	namespacepb "go.temporal.io/api/namespace/v1"
+	"go.temporal.io/api/operatorservice/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func describeNamespace(state enumspb.NamespaceState, retention time.Duration) *workflowservice.DescribeNamespaceResponse {
+	return &workflowservice.DescribeNamespaceResponse{
+		NamespaceInfo: &namespacepb.NamespaceInfo{Id: "ns-id", State: state},
+		Config:        &namespacepb.NamespaceConfig{WorkflowExecutionRetentionTtl: durationpb.New(retention)},
+	}
+}
+
+func describeTaskQueue(identities ...string) *workflowservice.DescribeTaskQueueResponse {
+	describe := &workflowservice.DescribeTaskQueueResponse{}
+	for _, identity := range identities {
+		describe.Pollers = append(describe.Pollers, &taskqueuepb.PollerInfo{Identity: identity})
+	}
+	return describe
+}
+
+func Test_EvaluateNamespace(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		describe *workflowservice.DescribeNamespaceResponse
+		status   Status
+	}{
+		{"registered", describeNamespace(enumspb.NAMESPACE_STATE_REGISTERED, 72*time.Hour), StatusOK},
+		{"short retention", describeNamespace(enumspb.NAMESPACE_STATE_REGISTERED, time.Hour), StatusWarn},
+		{"deprecated", describeNamespace(enumspb.NAMESPACE_STATE_DEPRECATED, 72*time.Hour), StatusCrit},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result := evaluateNamespace(test.describe, 24*time.Hour)
+			require.Equal(t, test.status, result.Status, result.Message)
+		})
+	}
+	require.Equal(t, StatusOK, evaluateNamespace(describeNamespace(enumspb.NAMESPACE_STATE_REGISTERED, time.Hour), 0).Status)
+}
+
+func Test_EvaluateTaskQueue(t *testing.T) {
+	require.Equal(t, StatusOK, evaluateTaskQueue(describeTaskQueue("w1"), describeTaskQueue("w1", "w2")).Status)
+	require.Equal(t, StatusWarn, evaluateTaskQueue(describeTaskQueue(), describeTaskQueue("w1")).Status)
+	require.Equal(t, StatusWarn, evaluateTaskQueue(describeTaskQueue("w1"), describeTaskQueue()).Status)
+	result := evaluateTaskQueue(describeTaskQueue(), describeTaskQueue())
+	require.Equal(t, StatusCrit, result.Status)
+	require.Equal(t, []string{}, result.Details["workflowPollers"])
+}
+
+func Test_EvaluateSearchAttributes(t *testing.T) {
+	list := &operatorservice.ListSearchAttributesResponse{
+		CustomAttributes: map[string]enumspb.IndexedValueType{"CustomerId": enumspb.INDEXED_VALUE_TYPE_KEYWORD},
+		SystemAttributes: map[string]enumspb.IndexedValueType{"WorkflowType": enumspb.INDEXED_VALUE_TYPE_KEYWORD},
+	}
+	require.Equal(t, StatusOK, evaluateSearchAttributes(list, []string{"CustomerId", "WorkflowType"}).Status)
+	result := evaluateSearchAttributes(list, []string{"CustomerId", "OrderId"})
+	require.Equal(t, StatusCrit, result.Status)
+	require.Equal(t, []string{"OrderId"}, result.Details["missing"])
+}
+
+func Test_EvaluateClockSkew(t *testing.T) {
+	require.Equal(t, StatusOK, evaluateClockSkew(500*time.Millisecond, 2*time.Second, 10*time.Second).Status)
+	require.Equal(t, StatusWarn, evaluateClockSkew(-3*time.Second, 2*time.Second, 10*time.Second).Status)
+	require.Equal(t, StatusCrit, evaluateClockSkew(time.Minute, 2*time.Second, 10*time.Second).Status)
+}
+
+func Test_EvaluateServerTime(t *testing.T) {
+	local := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, StatusOK,
+		evaluateServerTime([]string{"Wed, 01 May 2024 12:00:01 GMT"}, local, 2*time.Second, 10*time.Second).Status)
+	require.Equal(t, StatusCrit,
+		evaluateServerTime([]string{"Wed, 01 May 2024 12:01:00 GMT"}, local, 2*time.Second, 10*time.Second).Status)
+	// An unknown skew is not reported as in sync.
+	require.Equal(t, StatusWarn, evaluateServerTime(nil, local, 2*time.Second, 10*time.Second).Status)
+	require.Equal(t, StatusWarn, evaluateServerTime([]string{"yesterday"}, local, 2*time.Second, 10*time.Second).Status)
+}
+
+func Test_Report(t *testing.T) {
+	report := newReport([]Result{
+		{Name: "server", Status: StatusOK},
+		{Name: "namespace", Status: StatusWarn},
+	})
+	require.Equal(t, StatusWarn, report.Status)
+	require.Equal(t, 1, report.Status.ExitCode())
+	require.Equal(t, 2, StatusCrit.ExitCode())
+
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	require.Contains(t, string(encoded), `"status":"WARN"`)
+	require.Contains(t, string(encoded), `"name":"namespace"`)
+}
+
+func Test_ParseFlags(t *testing.T) {
+	_, err := ParseFlags([]string{"-task-queues", "a"})
+	require.Error(t, err, "client cert and key are required")
+
+	certFile, keyFile := writeClientCert(t)
+	tlsArgs := []string{"-client-cert", certFile, "-client-key", keyFile}
+	config, err := ParseFlags(append(tlsArgs,
+		"-task-queues", "a, b",
+		"-search-attributes", "CustomerId",
+		"-min-retention", "72h",
+		"-clock-skew-warn", "3s",
+		"-clock-skew-crit", "30s",
+		"-timeout", "5s",
+	))
+	require.NoError(t, err)
+	require.Equal(t, ProbeOptions{
+		TaskQueues:       []string{"a", "b"},
+		SearchAttributes: []string{"CustomerId"},
+		MinRetention:     72 * time.Hour,
+		ClockSkewWarn:    3 * time.Second,
+		ClockSkewCrit:    30 * time.Second,
+		Timeout:          5 * time.Second,
+	}, config.Probe)
+	require.Nil(t, config.Watch)
+
+	_, err = ParseFlags(append(tlsArgs, "-clock-skew-warn", "500ms"))
+	require.ErrorContains(t, err, "-clock-skew-warn must be at least 1s")
+	config, err = ParseFlags(append(tlsArgs, "-clock-skew-warn", "0"))
+	require.NoError(t, err)
+	require.Zero(t, config.Probe.ClockSkewWarn)
+}
+
+func Test_SplitList(t *testing.T) {
+	require.Equal(t, []string{"a", "b"}, splitList(" a, ,b "))
+	require.Nil(t, splitList(""))
+}
+
+// writeClientCert writes a self-signed certificate and its key to PEM files
+// and returns their paths.
+func writeClientCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "healthcheck"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
@@ -4,58 +4,139 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
-	"go.temporal.io/api/workflowservice/v1"
+	"github.com/uber-go/tally/v4/prometheus"
 	"go.temporal.io/sdk/client"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+
+	"github.com/taonic/my-samples-go/lib"
 )
 
 func main() {
-	if err := run(); err != nil {
-		log.Fatal(err)
-	}
+	os.Exit(run())
 }
 
-func run() error {
-	clientOptions, err := ParseClientOptionFlags(os.Args[1:])
+// run probes the namespace, writes the report as JSON to stdout and returns
+// the Nagios exit code of its status, or 3 (UNKNOWN) if it could not probe.
+func run() int {
+	config, err := ParseFlags(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Invalid arguments: %v", err)
+		log.Printf("Invalid arguments: %v", err)
+		return exitUnknown
+	}
+	if config.Watch != nil {
+		if err := watch(config); err != nil {
+			log.Print(err)
+			return exitUnknown
+		}
+		return 0
 	}
-	c, err := client.Dial(clientOptions)
+
+	var report Report
+	c, err := client.Dial(config.Client)
 	if err != nil {
-		log.Fatalln("Unable to create client", err)
+		report = newReport([]Result{{
+			Name:    "server",
+			Status:  StatusCrit,
+			Message: fmt.Sprintf("unable to create client: %v", err),
+		}})
+	} else {
+		defer c.Close()
+		prober := &Prober{Client: c, Namespace: config.Client.Namespace, Options: config.Probe}
+		report = prober.Run(context.Background())
 	}
-	defer c.Close()
 
-	// Check server health status
-	response, err := c.CheckHealth(context.Background(), nil)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("Unable to write report: %v", err)
+		return exitUnknown
+	}
+	return report.Status.ExitCode()
+}
+
+// watch probes the cluster until interrupted, exporting the SDK metrics of
+// the client alongside those of the probes.
+func watch(config Config) error {
+	scope := lib.NewPrometheusScope(prometheus.Configuration{
+		ListenAddress: config.Watch.MetricsAddress,
+		TimerType:     "histogram",
+	})
+	config.Client.MetricsHandler = sdktally.NewMetricsHandler(scope)
+	c, err := client.Dial(config.Client)
 	if err != nil {
-		return fmt.Errorf("health check failed: %w", err)
+		return fmt.Errorf("unable to create client: %w", err)
 	}
+	defer c.Close()
+	return runWatch(c, config.Client.Namespace, config.Probe, *config.Watch, scope)
+}
 
-	log.Printf("Health check successful - Status: %s", response)
+// exitUnknown is the Nagios exit code for a probe that could not run.
+const exitUnknown = 3
 
-	// Describe the first namespace if available
-	namespace := clientOptions.Namespace
-	if len(namespace) > 0 {
-		describe, err := c.WorkflowService().DescribeNamespace(context.Background(), &workflowservice.DescribeNamespaceRequest{
-			Namespace: clientOptions.Namespace,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to describe namespace %s: %w", namespace, err)
-		}
-		log.Printf("Namespace %s details - ID: %s, State: %s", namespace, describe.NamespaceInfo.Id, describe.NamespaceInfo.State)
+// Config is the configuration parsed from the flags.
+type Config struct {
+	Client client.Options
+	Probe  ProbeOptions
+	// Watch is set in watch mode.
+	Watch *WatchOptions
+}
+
+// ParseFlags parses the client options, and the options of the checks.
+func ParseFlags(args []string) (Config, error) {
+	set := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	probeOptions := ProbeOptions{}
+	taskQueues := set.String("task-queues", "", "Comma-separated task queues that must have workflow and activity pollers")
+	searchAttributes := set.String("search-attributes", "", "Comma-separated search attributes that must be registered")
+	set.DurationVar(&probeOptions.MinRetention, "min-retention", 24*time.Hour, "Warn about a namespace retention below this, 0 to disable")
+	set.DurationVar(&probeOptions.ClockSkewWarn, "clock-skew-warn", 2*time.Second, "Warn about a clock skew from the server above this, at least 1s or 0 to disable")
+	set.DurationVar(&probeOptions.ClockSkewCrit, "clock-skew-crit", 10*time.Second, "Fail on a clock skew from the server above this, at least 1s or 0 to disable")
+	set.DurationVar(&probeOptions.Timeout, "timeout", 10*time.Second, "Timeout of each check")
+	watchOptions := WatchOptions{}
+	watchMode := set.Bool("watch", false, "Probe continuously and export latency histograms and failure counters to Prometheus; "+
+		"-task-queues, -search-attributes, -min-retention and the clock skew thresholds only apply without it")
+	set.DurationVar(&watchOptions.Interval, "interval", 30*time.Second, "Interval between probes in watch mode")
+	set.StringVar(&watchOptions.MetricsAddress, "metrics-address", "0.0.0.0:9090", "Address serving the Prometheus metrics in watch mode")
+	set.StringVar(&watchOptions.TaskQueue, "synthetic-task-queue", "healthcheck", "Task queue of the synthetic workflow in watch mode")
+	clientOptions, err := parseClientOptionFlags(set, args)
+	if err != nil {
+		return Config{}, err
 	}
+	// The Date header the clock skew is estimated from has a resolution of a
+	// second.
+	if probeOptions.ClockSkewWarn > 0 && probeOptions.ClockSkewWarn < time.Second {
+		return Config{}, fmt.Errorf("-clock-skew-warn must be at least 1s, got %s", probeOptions.ClockSkewWarn)
+	} else if probeOptions.ClockSkewCrit > 0 && probeOptions.ClockSkewCrit < time.Second {
+		return Config{}, fmt.Errorf("-clock-skew-crit must be at least 1s, got %s", probeOptions.ClockSkewCrit)
+	}
+	probeOptions.TaskQueues = splitList(*taskQueues)
+	probeOptions.SearchAttributes = splitList(*searchAttributes)
+	config := Config{Client: clientOptions, Probe: probeOptions}
+	if *watchMode {
+		config.Watch = &watchOptions
+	}
+	return config, nil
+}
 
-	return nil
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
-func ParseClientOptionFlags(args []string) (client.Options, error) {
+func parseClientOptionFlags(set *flag.FlagSet, args []string) (client.Options, error) {
 	// Parse args
-	set := flag.NewFlagSet("hello-world-mtls", flag.ExitOnError)
 	targetHost := set.String("target-host", "localhost:7233", "Host:port for the server")
 	namespace := set.String("namespace", "default", "Namespace for the server")
 	serverRootCACert := set.String("server-root-ca-cert", "", "Optional path to root server CA cert")
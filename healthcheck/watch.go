@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uber-go/tally/v4"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// latencyMetric is the timer, exported as a histogram, of the latency of
+	// each probe, tagged with probe.
+	latencyMetric = "healthcheck_latency"
+	// failuresMetric counts the failed probes, tagged with probe.
+	failuresMetric = "healthcheck_failures"
+	probeTagName   = "probe"
+)
+
+// WatchOptions configure the watch mode.
+type WatchOptions struct {
+	// Interval between rounds of probes.
+	Interval time.Duration
+	// MetricsAddress serves the Prometheus metrics.
+	MetricsAddress string
+	// TaskQueue the synthetic workflow runs on, polled by the probe itself.
+	TaskQueue string
+}
+
+// NoopWorkflow is the synthetic workflow of the round trip probe.
+func NoopWorkflow(ctx workflow.Context) error {
+	return nil
+}
+
+// probe is a single black-box measurement of the cluster.
+type probe struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// watcher runs probes in rounds and records their latency and failures.
+type watcher struct {
+	probes  []probe
+	scope   tally.Scope
+	timeout time.Duration
+}
+
+func newWatcher(c client.Client, namespace, taskQueue string, scope tally.Scope, timeout time.Duration) *watcher {
+	return &watcher{
+		scope:   scope,
+		timeout: timeout,
+		probes: []probe{
+			{name: "check_health", run: func(ctx context.Context) error {
+				_, err := c.CheckHealth(ctx, &client.CheckHealthRequest{})
+				return err
+			}},
+			{name: "describe_namespace", run: func(ctx context.Context) error {
+				_, err := c.WorkflowService().DescribeNamespace(ctx,
+					&workflowservice.DescribeNamespaceRequest{Namespace: namespace})
+				return err
+			}},
+			{name: "workflow_round_trip", run: func(ctx context.Context) error {
+				run, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+					ID:                       "healthcheck-" + uuid.NewString(),
+					TaskQueue:                taskQueue,
+					WorkflowExecutionTimeout: timeout,
+				}, NoopWorkflow)
+				if err != nil {
+					return err
+				}
+				return run.Get(ctx, nil)
+			}},
+		},
+	}
+}
+
+// round runs every probe once, and returns the number of failed probes.
+func (w *watcher) round(ctx context.Context) int {
+	failed := 0
+	for _, p := range w.probes {
+		scope := w.scope.Tagged(map[string]string{probeTagName: p.name})
+		probeCtx, cancel := context.WithTimeout(ctx, w.timeout)
+		start := time.Now()
+		err := p.run(probeCtx)
+		latency := time.Since(start)
+		cancel()
+		scope.Timer(latencyMetric).Record(latency)
+		if err != nil {
+			failed++
+			scope.Counter(failuresMetric).Inc(1)
+			log.Printf("Probe %s failed after %v: %v", p.name, latency, err)
+		}
+	}
+	return failed
+}
+
+// watch runs rounds of probes every interval until interruptCh is closed.
+func (w *watcher) watch(interval time.Duration, interruptCh <-chan interface{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if failed := w.round(context.Background()); failed == 0 {
+			log.Printf("All %d probes succeeded", len(w.probes))
+		}
+		select {
+		case <-interruptCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runWatch serves a worker for the synthetic workflow and probes the cluster
+// until interrupted.
+func runWatch(c client.Client, namespace string, probeOptions ProbeOptions, options WatchOptions, scope tally.Scope) error {
+	w := worker.New(c, options.TaskQueue, worker.Options{})
+	w.RegisterWorkflow(NoopWorkflow)
+	if err := w.Start(); err != nil {
+		return fmt.Errorf("unable to start worker: %w", err)
+	}
+	defer w.Stop()
+
+	log.Printf("Probing namespace %s every %v, metrics on %s", namespace, options.Interval, options.MetricsAddress)
+	newWatcher(c, namespace, options.TaskQueue, scope, probeOptions.Timeout).watch(options.Interval, worker.InterruptCh())
+	return nil
+}
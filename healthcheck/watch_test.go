@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally/v4"
+)
+
+func Test_WatcherRound(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	w := &watcher{
+		scope:   scope,
+		timeout: 10 * time.Millisecond,
+		probes: []probe{
+			{name: "ok", run: func(ctx context.Context) error { return nil }},
+			{name: "failing", run: func(ctx context.Context) error { return errors.New("unavailable") }},
+			{name: "slow", run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+		},
+	}
+	require.Equal(t, 2, w.round(context.Background()))
+	require.Equal(t, 2, w.round(context.Background()))
+
+	snapshot := scope.Snapshot()
+	for _, name := range []string{"ok", "failing", "slow"} {
+		timer, ok := snapshot.Timers()[latencyMetric+"+probe="+name]
+		require.True(t, ok, name)
+		require.Len(t, timer.Values(), 2, name)
+	}
+	require.GreaterOrEqual(t, snapshot.Timers()[latencyMetric+"+probe=slow"].Values()[0], 10*time.Millisecond)
+
+	failures := snapshot.Counters()
+	require.Equal(t, int64(2), failures[failuresMetric+"+probe=failing"].Value())
+	require.Equal(t, int64(2), failures[failuresMetric+"+probe=slow"].Value())
+	_, ok := failures[failuresMetric+"+probe=ok"]
+	require.False(t, ok)
+}
@@ -0,0 +1,264 @@
+// Package health serves the liveness and readiness of a Temporal worker to
+// Kubernetes probes.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.temporal.io/sdk/client"
+)
+
+// pollMetrics are the SDK metrics recorded once a poll returned, with or
+// without a task.
+var pollMetrics = map[string]bool{
+	"temporal_workflow_task_queue_poll_empty":     true,
+	"temporal_workflow_task_queue_poll_succeed":   true,
+	"temporal_activity_poll_no_task":              true,
+	"temporal_activity_schedule_to_start_latency": true,
+}
+
+// Checker checks the health of the server, as client.Client does.
+type Checker interface {
+	CheckHealth(ctx context.Context, request *client.CheckHealthRequest) (*client.CheckHealthResponse, error)
+}
+
+// Worker is started and stopped by Health.Run, as worker.Worker is.
+type Worker interface {
+	Start() error
+	Stop()
+}
+
+// Options configure Health.
+type Options struct {
+	// CheckInterval is how often the client checks the health of the server.
+	// Defaults to 10s.
+	CheckInterval time.Duration
+	// CheckTimeout bounds each health check. Defaults to 5s.
+	CheckTimeout time.Duration
+	// FailureThreshold is the number of consecutive failed health checks
+	// after which the worker is no longer live. Defaults to 3.
+	FailureThreshold int
+}
+
+// Health tracks the state of a worker:
+//   - it is live until it stopped, or its client failed FailureThreshold
+//     consecutive health checks;
+//   - it is ready once live, started and at least one poll succeeded. Polls
+//     of an idle task queue return after the long poll timeout of the server,
+//     about a minute.
+type Health struct {
+	options Options
+	fatal   chan error
+
+	mu       sync.Mutex
+	started  bool
+	stopped  bool
+	polled   bool
+	failures int
+	lastErr  error
+}
+
+// New returns the Health of a worker that has not started yet.
+func New(options Options) *Health {
+	if options.CheckInterval <= 0 {
+		options.CheckInterval = 10 * time.Second
+	}
+	if options.CheckTimeout <= 0 {
+		options.CheckTimeout = 5 * time.Second
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = 3
+	}
+	return &Health{options: options, fatal: make(chan error, 1)}
+}
+
+// Run starts w, checks the health of the server through c until interruptCh
+// is closed or the worker fails, and then stops w. Like worker.Worker.Run, it
+// returns the error the worker failed with, reported through OnFatalError.
+func (h *Health) Run(c Checker, w Worker, interruptCh <-chan interface{}) error {
+	if err := w.Start(); err != nil {
+		h.setStopped()
+		return err
+	}
+	h.mu.Lock()
+	h.started = true
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.checkClient(ctx, c)
+	}()
+
+	var err error
+	select {
+	case <-interruptCh:
+	case err = <-h.fatal:
+	}
+	h.setStopped()
+	cancel()
+	<-done
+	w.Stop()
+	return err
+}
+
+// OnFatalError is to be set as worker.Options.OnFatalError, so that Run
+// notices the worker stopping on its own.
+func (h *Health) OnFatalError(err error) {
+	select {
+	case h.fatal <- err:
+	default:
+	}
+}
+
+func (h *Health) checkClient(ctx context.Context, c Checker) {
+	ticker := time.NewTicker(h.options.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, h.options.CheckTimeout)
+		_, err := c.CheckHealth(checkCtx, &client.CheckHealthRequest{})
+		cancel()
+		h.mu.Lock()
+		if err != nil {
+			h.failures++
+		} else {
+			h.failures = 0
+		}
+		h.lastErr = err
+		h.mu.Unlock()
+	}
+}
+
+func (h *Health) setStopped() {
+	h.mu.Lock()
+	h.stopped = true
+	h.mu.Unlock()
+}
+
+func (h *Health) setPolled() {
+	h.mu.Lock()
+	h.polled = true
+	h.mu.Unlock()
+}
+
+// Live returns nil while the worker is live, and why it is not otherwise.
+func (h *Health) Live() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.liveLocked()
+}
+
+func (h *Health) liveLocked() error {
+	if h.stopped {
+		return fmt.Errorf("worker stopped")
+	}
+	if h.failures >= h.options.FailureThreshold {
+		return fmt.Errorf("%d consecutive health checks failed: %w", h.failures, h.lastErr)
+	}
+	return nil
+}
+
+// Ready returns nil once the worker is ready, and why it is not otherwise.
+func (h *Health) Ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.liveLocked(); err != nil {
+		return err
+	}
+	if !h.started {
+		return fmt.Errorf("worker not started")
+	}
+	if !h.polled {
+		return fmt.Errorf("no poll succeeded yet")
+	}
+	return nil
+}
+
+// Handler serves /livez and /readyz, with 200 and "ok", or 503 and the
+// reason.
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", probeHandler(h.Live))
+	mux.HandleFunc("/readyz", probeHandler(h.Ready))
+	return mux
+}
+
+func probeHandler(probe func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := probe(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// MetricsHandler wraps the metrics handler of the client of the worker, to
+// notice successful polls. next defaults to client.MetricsNopHandler.
+func (h *Health) MetricsHandler(next client.MetricsHandler) client.MetricsHandler {
+	if next == nil {
+		next = client.MetricsNopHandler
+	}
+	return &metricsHandler{health: h, next: next}
+}
+
+type metricsHandler struct {
+	health *Health
+	next   client.MetricsHandler
+}
+
+func (m *metricsHandler) WithTags(tags map[string]string) client.MetricsHandler {
+	return &metricsHandler{health: m.health, next: m.next.WithTags(tags)}
+}
+
+func (m *metricsHandler) Counter(name string) client.MetricsCounter {
+	counter := m.next.Counter(name)
+	if !pollMetrics[name] {
+		return counter
+	}
+	return counterFunc(func(d int64) {
+		m.health.setPolled()
+		counter.Inc(d)
+	})
+}
+
+func (m *metricsHandler) Gauge(name string) client.MetricsGauge {
+	return m.next.Gauge(name)
+}
+
+func (m *metricsHandler) Timer(name string) client.MetricsTimer {
+	timer := m.next.Timer(name)
+	if !pollMetrics[name] {
+		return timer
+	}
+	return timerFunc(func(d time.Duration) {
+		m.health.setPolled()
+		timer.Record(d)
+	})
+}
+
+// Unwrap returns the wrapped handler, for the SDK to find e.g. the tally
+// scope of a tally handler.
+func (m *metricsHandler) Unwrap() client.MetricsHandler {
+	return m.next
+}
+
+type counterFunc func(int64)
+
+func (c counterFunc) Inc(d int64) { c(d) }
+
+type timerFunc func(time.Duration)
+
+func (t timerFunc) Record(d time.Duration) { t(d) }
@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+)
+
+// fakeClient fails its health checks while err is set.
+type fakeClient struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (c *fakeClient) CheckHealth(context.Context, *client.CheckHealthRequest) (*client.CheckHealthResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &client.CheckHealthResponse{}, c.err
+}
+
+func (c *fakeClient) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+type fakeWorker struct {
+	startErr error
+	stopped  chan struct{}
+}
+
+func (w *fakeWorker) Start() error { return w.startErr }
+func (w *fakeWorker) Stop()        { close(w.stopped) }
+
+func probe(t *testing.T, server *httptest.Server, path string) (int, string) {
+	resp, err := http.Get(server.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func newTestHealth(t *testing.T) (*Health, *httptest.Server) {
+	h := New(Options{CheckInterval: 5 * time.Millisecond, FailureThreshold: 3})
+	server := httptest.NewServer(h.Handler())
+	t.Cleanup(server.Close)
+	return h, server
+}
+
+func Test_Health(t *testing.T) {
+	h, server := newTestHealth(t)
+	c := &fakeClient{}
+	w := &fakeWorker{stopped: make(chan struct{})}
+
+	status, body := probe(t, server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "worker not started", body)
+	status, _ = probe(t, server, "/livez")
+	require.Equal(t, http.StatusOK, status)
+
+	interruptCh := make(chan interface{})
+	runErr := make(chan error, 1)
+	go func() { runErr <- h.Run(c, w, interruptCh) }()
+
+	require.Eventually(t, func() bool {
+		_, body := probe(t, server, "/readyz")
+		return body == "no poll succeeded yet"
+	}, time.Second, 5*time.Millisecond)
+
+	// The SDK records an empty poll on the handler of the client.
+	h.MetricsHandler(nil).WithTags(map[string]string{"poller_type": "workflow_task"}).
+		Counter("temporal_workflow_task_queue_poll_empty").Inc(1)
+	status, body = probe(t, server, "/readyz")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "ok", body)
+
+	// A single failed health check is tolerated, FailureThreshold are not.
+	c.setErr(errors.New("unavailable"))
+	require.Eventually(t, func() bool {
+		status, _ := probe(t, server, "/livez")
+		return status == http.StatusServiceUnavailable
+	}, time.Second, 5*time.Millisecond)
+	_, body = probe(t, server, "/livez")
+	require.Contains(t, body, "consecutive health checks failed: unavailable")
+	status, _ = probe(t, server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+
+	c.setErr(nil)
+	require.Eventually(t, func() bool {
+		status, _ := probe(t, server, "/readyz")
+		return status == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+
+	close(interruptCh)
+	require.NoError(t, <-runErr)
+	<-w.stopped
+	status, body = probe(t, server, "/livez")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "worker stopped", body)
+}
+
+func Test_Health_FatalError(t *testing.T) {
+	h, server := newTestHealth(t)
+	w := &fakeWorker{stopped: make(chan struct{})}
+	runErr := make(chan error, 1)
+	go func() { runErr <- h.Run(&fakeClient{}, w, make(chan interface{})) }()
+
+	h.OnFatalError(errors.New("namespace not found"))
+	require.EqualError(t, <-runErr, "namespace not found")
+	<-w.stopped
+	status, _ := probe(t, server, "/livez")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func Test_Health_StartError(t *testing.T) {
+	h, server := newTestHealth(t)
+	w := &fakeWorker{startErr: errors.New("invalid options")}
+	require.EqualError(t, h.Run(&fakeClient{}, w, make(chan interface{})), "invalid options")
+	status, _ := probe(t, server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func Test_MetricsHandler(t *testing.T) {
+	h := New(Options{})
+	handler := h.MetricsHandler(nil)
+	handler.Counter("temporal_request").Inc(1)
+	handler.Timer("temporal_workflow_endtoend_latency").Record(time.Second)
+	require.False(t, h.polled)
+
+	handler.Timer("temporal_activity_schedule_to_start_latency").Record(time.Second)
+	require.True(t, h.polled)
+	require.Equal(t, client.MetricsNopHandler, handler.(interface{ Unwrap() client.MetricsHandler }).Unwrap())
+}
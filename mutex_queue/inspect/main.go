@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+
+	mutex "github.com/taonic/my-samples-go/mutex_queue"
+)
+
+func main() {
+	var (
+		workflowID   string
+		forceRelease bool
+		evict        string
+		pause        bool
+		resume       bool
+	)
+	flag.StringVar(&workflowID, "w", "", "Mutex workflow ID to administer. Lists all mutex workflows when empty.")
+	flag.BoolVar(&forceRelease, "force-release", false, "Release the lock on behalf of its current holder.")
+	flag.StringVar(&evict, "evict", "", "Workflow ID of a waiter to remove from the queue.")
+	flag.BoolVar(&pause, "pause", false, "Stop granting the lock to waiters.")
+	flag.BoolVar(&resume, "resume", false, "Resume granting the lock to waiters.")
+	flag.Parse()
+
+	// The client is a heavyweight object that should be created once per process.
+	c, err := client.Dial(client.Options{
+		HostPort: client.DefaultHostPort,
+	})
+	if err != nil {
+		log.Fatalln("Unable to create client", err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	if workflowID == "" {
+		if err := listMutexes(ctx, c); err != nil {
+			log.Fatalln("Unable to list mutex workflows", err)
+		}
+		return
+	}
+
+	var updateName string
+	var args []interface{}
+	switch {
+	case forceRelease:
+		updateName = mutex.ForceReleaseUpdateName
+	case evict != "":
+		updateName, args = mutex.EvictWaiterUpdateName, []interface{}{evict}
+	case pause:
+		updateName = mutex.PauseUpdateName
+	case resume:
+		updateName = mutex.ResumeUpdateName
+	}
+	if updateName != "" {
+		handle, err := c.UpdateWorkflow(ctx, client.UpdateWorkflowOptions{
+			WorkflowID:   workflowID,
+			UpdateName:   updateName,
+			Args:         args,
+			WaitForStage: client.WorkflowUpdateStageCompleted,
+		})
+		if err != nil {
+			log.Fatalln("Unable to update workflow", err)
+		}
+		if err := handle.Get(ctx, nil); err != nil {
+			log.Fatalln("Update failed", err)
+		}
+		log.Println("Applied", updateName, "to", workflowID)
+	}
+
+	state, err := queryState(ctx, c, workflowID)
+	if err != nil {
+		log.Fatalln("Unable to query workflow", err)
+	}
+	printState(workflowID, state)
+}
+
+// listMutexes prints the state of every running mutex workflow.
+func listMutexes(ctx context.Context, c client.Client) error {
+	var nextPageToken []byte
+	for {
+		resp, err := c.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Query:         "WorkflowId STARTS_WITH 'mutex:' AND ExecutionStatus = 'Running'",
+			NextPageToken: nextPageToken,
+		})
+		if err != nil {
+			return err
+		}
+		for _, execution := range resp.Executions {
+			workflowID := execution.GetExecution().GetWorkflowId()
+			state, err := queryState(ctx, c, workflowID)
+			if err != nil {
+				log.Println("Unable to query workflow", workflowID, err)
+				continue
+			}
+			printState(workflowID, state)
+		}
+		nextPageToken = resp.NextPageToken
+		if len(nextPageToken) == 0 {
+			return nil
+		}
+	}
+}
+
+func queryState(ctx context.Context, c client.Client, workflowID string) (mutex.MutexState, error) {
+	var state mutex.MutexState
+	resp, err := c.QueryWorkflow(ctx, workflowID, "", mutex.StateQueryName)
+	if err != nil {
+		return state, err
+	}
+	return state, resp.Get(&state)
+}
+
+func printState(workflowID string, state mutex.MutexState) {
+	now := time.Now()
+	fmt.Printf("%s (resource=%s acquisitions=%d paused=%t)\n",
+		workflowID, state.ResourceID, state.Acquisitions, state.Paused)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if state.Holder != nil {
+		fmt.Fprintf(w, "  holder\t%s\theld %s\n",
+			state.Holder.WorkflowID, now.Sub(state.Holder.AcquiredAt).Round(time.Second))
+	} else {
+		fmt.Fprintf(w, "  holder\t-\t\n")
+	}
+	for i, waiter := range state.Waiters {
+		fmt.Fprintf(w, "  waiter %d\t%s\twaiting %s\n",
+			i+1, waiter.WorkflowID, waiter.WaitTime.Round(time.Second))
+	}
+	w.Flush()
+}
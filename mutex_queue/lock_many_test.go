@@ -0,0 +1,228 @@
+package mutex_queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	testLockNamespace = "test"
+	proxySignalName   = "signal-with-start-proxy"
+)
+
+type (
+	// proxyRequest is forwarded from the mocked SignalWithStartMutexWorkflowActivity
+	// to lockManyTestWorkflow.
+	proxyRequest struct {
+		ResourceID string
+		Request    LockRequest
+	}
+
+	// locker describes a lockerWorkflow run.
+	locker struct {
+		ResourceIDs []string
+		// StartDelay postpones the lock request.
+		StartDelay time.Duration
+		// Timeout bounds LockMany when set.
+		Timeout time.Duration
+	}
+
+	// criticalSection records when a locker held its locks.
+	criticalSection struct {
+		WorkflowID  string
+		ResourceIDs []string
+		Start, End  time.Time
+		Err         string
+	}
+)
+
+// lockManyTestWorkflow stands in for the Temporal server: it runs every mutex
+// workflow as a child and forwards lock requests to them, starting a new run
+// when the previous one has completed. It also runs the lockers as children
+// and returns their critical sections.
+func lockManyTestWorkflow(ctx workflow.Context, lockers []locker) ([]criticalSection, error) {
+	mutexes := make(map[string]workflow.ChildWorkflowFuture)
+	signalWithStart := func(r proxyRequest) {
+		workflowID := fmt.Sprintf("mutex:%s:%s", testLockNamespace, r.ResourceID)
+		for {
+			mutex, ok := mutexes[workflowID]
+			if !ok || mutex.IsReady() {
+				childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{WorkflowID: workflowID})
+				mutex = workflow.ExecuteChildWorkflow(childCtx, MutexWorkflowWithCancellation,
+					testLockNamespace, r.ResourceID, time.Minute, nil)
+				mutexes[workflowID] = mutex
+			}
+			if mutex.SignalChildWorkflow(ctx, RequestLockSignalName, r.Request).Get(ctx, nil) == nil {
+				return
+			}
+		}
+	}
+
+	sections := make([]criticalSection, len(lockers))
+	completed := 0
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, proxySignalName), func(c workflow.ReceiveChannel, more bool) {
+		var r proxyRequest
+		c.Receive(ctx, &r)
+		signalWithStart(r)
+	})
+	for i, l := range lockers {
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID: fmt.Sprintf("locker-%d", i),
+		})
+		f := workflow.ExecuteChildWorkflow(childCtx, lockerWorkflow, l)
+		selector.AddFuture(f, func(f workflow.Future) {
+			if err := f.Get(ctx, &sections[i]); err != nil {
+				sections[i] = criticalSection{WorkflowID: fmt.Sprintf("locker-%d", i), Err: err.Error()}
+			}
+			completed++
+		})
+	}
+	for completed < len(lockers) {
+		selector.Select(ctx)
+	}
+	return sections, nil
+}
+
+func lockerWorkflow(ctx workflow.Context, l locker) (criticalSection, error) {
+	workflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	if l.StartDelay > 0 {
+		_ = workflow.Sleep(ctx, l.StartDelay)
+	}
+	var options LockOptions
+	if l.Timeout > 0 {
+		options.Deadline = workflow.Now(ctx).Add(l.Timeout)
+	}
+	unlock, err := NewMutex(workflowID, testLockNamespace).LockMany(ctx, time.Minute, options, l.ResourceIDs...)
+	if err != nil {
+		return criticalSection{}, err
+	}
+	section := criticalSection{WorkflowID: workflowID, ResourceIDs: l.ResourceIDs, Start: workflow.Now(ctx)}
+	_ = workflow.Sleep(ctx, 10*time.Second)
+	section.End = workflow.Now(ctx)
+	return section, unlock()
+}
+
+func newLockManyTestEnvironment() *testsuite.TestWorkflowEnvironment {
+	env := (&testsuite.WorkflowTestSuite{}).NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(MutexWorkflowWithCancellation)
+	env.RegisterWorkflow(lockerWorkflow)
+	env.OnActivity(SignalWithStartMutexWorkflowActivity, mock.Anything, testLockNamespace, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, namespace, resourceID string, request LockRequest, unlockTimeout time.Duration) (*workflow.Execution, error) {
+			env.SignalWorkflow(proxySignalName, proxyRequest{ResourceID: resourceID, Request: request})
+			return &workflow.Execution{ID: fmt.Sprintf("mutex:%s:%s", namespace, resourceID)}, nil
+		})
+	return env
+}
+
+func Test_LockMany_CrossingTransfersDoNotDeadlock(t *testing.T) {
+	env := newLockManyTestEnvironment()
+
+	// Transfers between the same accounts in opposite directions, plus one that
+	// touches all three, all started at once.
+	lockers := []locker{
+		{ResourceIDs: []string{"account-1", "account-2"}},
+		{ResourceIDs: []string{"account-2", "account-1"}},
+		{ResourceIDs: []string{"account-2", "account-3"}},
+		{ResourceIDs: []string{"account-3", "account-2"}},
+		{ResourceIDs: []string{"account-3", "account-1", "account-2"}},
+		{ResourceIDs: []string{"account-1", "account-3"}},
+	}
+	env.ExecuteWorkflow(lockManyTestWorkflow, lockers)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var sections []criticalSection
+	require.NoError(t, env.GetWorkflowResult(&sections))
+	require.Len(t, sections, len(lockers))
+
+	for i, a := range sections {
+		require.Empty(t, a.Err)
+		for _, b := range sections[i+1:] {
+			overlapping := a.Start.Before(b.End) && b.Start.Before(a.End)
+			sharesResource := false
+			for _, resourceID := range a.ResourceIDs {
+				sharesResource = sharesResource || slices.Contains(b.ResourceIDs, resourceID)
+			}
+			require.False(t, overlapping && sharesResource,
+				"%s and %s held %v and %v at the same time", a.WorkflowID, b.WorkflowID, a.ResourceIDs, b.ResourceIDs)
+		}
+	}
+}
+
+func Test_LockMany_ReleasesPartialLocksOnDeadline(t *testing.T) {
+	env := newLockManyTestEnvironment()
+
+	// locker-0 holds account-2 for 10s. locker-1 acquires account-1 but gives
+	// up on account-2 after 5s, which must release account-1 so that locker-2
+	// gets it before locker-0 is done.
+	lockers := []locker{
+		{ResourceIDs: []string{"account-2"}},
+		{ResourceIDs: []string{"account-1", "account-2"}, StartDelay: time.Second, Timeout: 5 * time.Second},
+		{ResourceIDs: []string{"account-1"}, StartDelay: 2 * time.Second},
+	}
+	env.ExecuteWorkflow(lockManyTestWorkflow, lockers)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var sections []criticalSection
+	require.NoError(t, env.GetWorkflowResult(&sections))
+
+	require.Empty(t, sections[0].Err)
+	require.Contains(t, sections[1].Err, "was not granted before the deadline")
+	require.Empty(t, sections[2].Err)
+	require.True(t, sections[2].Start.Before(sections[0].End))
+}
+
+// lateGrantWorkflow gives up on account-1 at its deadline, then locks
+// account-2, and returns how long after its start it acquired account-2.
+func lateGrantWorkflow(ctx workflow.Context) (time.Duration, error) {
+	start := workflow.Now(ctx)
+	mutex := NewMutex(workflow.GetInfo(ctx).WorkflowExecution.ID, testLockNamespace)
+	_, err := mutex.LockWithOptions(ctx, "account-1", time.Minute, LockOptions{Deadline: start.Add(5 * time.Second)})
+	var applicationErr *temporal.ApplicationError
+	if !errors.As(err, &applicationErr) || applicationErr.Type() != LockDeadlineExceededErrorType {
+		return 0, fmt.Errorf("expected the account-1 deadline to pass, got %v", err)
+	}
+	if _, err := mutex.LockWithCancellation(ctx, "account-2", time.Minute); err != nil {
+		return 0, err
+	}
+	return workflow.Now(ctx).Sub(start), nil
+}
+
+func Test_LockWithOptions_DeadlineWithUnresponsiveMutex(t *testing.T) {
+	env := (&testsuite.WorkflowTestSuite{}).NewTestWorkflowEnvironment()
+	// The mutex workflows never answer on their own.
+	env.OnActivity(SignalWithStartMutexWorkflowActivity, mock.Anything, testLockNamespace, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, namespace, resourceID string, request LockRequest, unlockTimeout time.Duration) (*workflow.Execution, error) {
+			return &workflow.Execution{ID: fmt.Sprintf("mutex:%s:%s", namespace, resourceID)}, nil
+		})
+	env.OnSignalExternalWorkflow(mock.Anything, "mutex:test:account-1", "", WithdrawLockSignalName, mock.Anything).Return(nil).Once()
+
+	// account-1 is granted after the deadline, which must not be taken for the
+	// grant of account-2.
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(acquireLockSignalName("account-1"), "unlock-event-1")
+	}, 6*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(acquireLockSignalName("account-2"), "unlock-event-2")
+	}, 8*time.Second)
+	env.ExecuteWorkflow(lateGrantWorkflow)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var acquiredAfter time.Duration
+	require.NoError(t, env.GetWorkflowResult(&acquiredAfter))
+	require.Equal(t, 8*time.Second, acquiredAfter)
+	env.AssertExpectations(t)
+}
@@ -0,0 +1,68 @@
+package mutex_queue
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// emitted by MutexWorkflowWithCancellation
+	queueDepthGauge     = "mutex_queue_depth"
+	waitLatency         = "mutex_wait_latency"
+	holdLatency         = "mutex_hold_latency"
+	forcedReleaseCount  = "mutex_forced_releases"
+	requestCancelCount  = "mutex_request_cancellations"
+	acquisitionsCounter = "mutex_acquisitions"
+
+	// emitted by Mutex.LockWithOptions
+	acquireLatency      = "mutex_acquire_latency"
+	acquireFailureCount = "mutex_acquire_failures"
+
+	lockNamespaceTag = "lock_namespace"
+	resourceIDTag    = "resource_id"
+	reasonTag        = "reason"
+)
+
+// metricsHandler returns a replay-safe handler tagged with the lock namespace.
+func metricsHandler(ctx workflow.Context, lockNamespace string) client.MetricsHandler {
+	return workflow.GetMetricsHandler(ctx).WithTags(map[string]string{lockNamespaceTag: lockNamespace})
+}
+
+// recordQueueDepth is also tagged with the resource, since each mutex workflow
+// reports the depth of its own queue.
+func (q *queuedMutex) recordQueueDepth(ctx workflow.Context) {
+	metricsHandler(ctx, q.lockNamespace).WithTags(map[string]string{resourceIDTag: q.resourceID}).
+		Gauge(queueDepthGauge).Update(float64(len(q.queue)))
+}
+
+func (q *queuedMutex) recordGranted(ctx workflow.Context, waiter LockWaiter) {
+	handler := metricsHandler(ctx, q.lockNamespace)
+	handler.Timer(waitLatency).Record(workflow.Now(ctx).Sub(waiter.EnqueuedAt))
+	handler.Counter(acquisitionsCounter).Inc(1)
+}
+
+func (q *queuedMutex) recordCancelled(ctx workflow.Context, reason string) {
+	metricsHandler(ctx, q.lockNamespace).WithTags(map[string]string{reasonTag: reason}).
+		Counter(requestCancelCount).Inc(1)
+}
+
+// recordReleased records how long the lock was held and, for anything but a
+// release by the holder itself, why it was taken away.
+func (q *queuedMutex) recordReleased(ctx workflow.Context, holder *LockHolder, reason string) {
+	handler := metricsHandler(ctx, q.lockNamespace)
+	handler.Timer(holdLatency).Record(workflow.Now(ctx).Sub(holder.AcquiredAt))
+	if reason != releasedByHolder {
+		handler.WithTags(map[string]string{reasonTag: reason}).Counter(forcedReleaseCount).Inc(1)
+	}
+}
+
+func recordAcquired(ctx workflow.Context, lockNamespace string, requestedAt time.Time) {
+	metricsHandler(ctx, lockNamespace).Timer(acquireLatency).Record(workflow.Now(ctx).Sub(requestedAt))
+}
+
+func recordAcquireFailed(ctx workflow.Context, lockNamespace string, reason string) {
+	metricsHandler(ctx, lockNamespace).WithTags(map[string]string{reasonTag: reason}).
+		Counter(acquireFailureCount).Inc(1)
+}
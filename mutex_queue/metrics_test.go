@@ -0,0 +1,49 @@
+package mutex_queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally/v4"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func Test_MutexWorkflow_Metrics(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	testSuite := &testsuite.WorkflowTestSuite{}
+	testSuite.SetMetricsHandler(sdktally.NewMetricsHandler(scope))
+	env := testSuite.NewTestWorkflowEnvironment()
+	for _, id := range []string{"A", "B"} {
+		env.OnSignalExternalWorkflow(mock.Anything, id, "", acquireLockSignalName("resource"), "unlock-event-"+id).Return(nil).Once()
+	}
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "A"})
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "B"})
+	}, 2*time.Second)
+	env.RegisterDelayedCallback(func() {
+		depth := scope.Snapshot().Gauges()["mutex_queue_depth+lock_namespace=ns,resource_id=resource"]
+		require.NotNil(t, depth)
+		require.Equal(t, float64(1), depth.Value(), "B waits for A")
+		env.SignalWorkflow("unlock-event-A", "A")
+	}, 4*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-B", "B")
+	}, 5*time.Second)
+
+	env.ExecuteWorkflow(MutexWorkflowWithCancellation, "ns", "resource", time.Minute, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	snapshot := scope.Snapshot()
+	require.Equal(t, float64(0), snapshot.Gauges()["mutex_queue_depth+lock_namespace=ns,resource_id=resource"].Value())
+	require.Equal(t, int64(2), snapshot.Counters()["mutex_acquisitions+lock_namespace=ns"].Value())
+	require.Equal(t, []time.Duration{0, 2 * time.Second}, snapshot.Timers()["mutex_wait_latency+lock_namespace=ns"].Values())
+	require.Equal(t, []time.Duration{3 * time.Second, time.Second}, snapshot.Timers()["mutex_hold_latency+lock_namespace=ns"].Values())
+	require.NotContains(t, snapshot.Counters(), "mutex_forced_releases+lock_namespace=ns,reason=released")
+}
@@ -0,0 +1,164 @@
+package mutex_queue
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// HolderQueryName query name returning the current lock holder
+	HolderQueryName = "holder"
+	// WaitersQueryName query name returning the workflows waiting for the lock
+	WaitersQueryName = "waiters"
+	// AcquisitionsQueryName query name returning the number of granted locks
+	AcquisitionsQueryName = "acquisitions"
+	// StateQueryName query name returning holder, waiters and counters in one call
+	StateQueryName = "state"
+
+	// ForceReleaseUpdateName update name for releasing the lock on behalf of its holder
+	ForceReleaseUpdateName = "force-release"
+	// EvictWaiterUpdateName update name for removing a workflow from the wait queue
+	EvictWaiterUpdateName = "evict-waiter"
+	// PauseUpdateName update name for pausing lock granting
+	PauseUpdateName = "pause-granting"
+	// ResumeUpdateName update name for resuming lock granting
+	ResumeUpdateName = "resume-granting"
+)
+
+type (
+	// LockHolder describes the workflow currently holding the lock.
+	LockHolder struct {
+		WorkflowID         string
+		ReleaseChannelName string
+		AcquiredAt         time.Time
+		TraceContext       map[string]string `json:",omitempty"`
+	}
+
+	// LockWaiter describes a workflow waiting for the lock.
+	LockWaiter struct {
+		LockRequest
+		EnqueuedAt time.Time
+		// WaitTime is how long the waiter has been queued, set in query
+		// results only.
+		WaitTime time.Duration `json:",omitempty"`
+	}
+
+	// MutexState is the result of the StateQueryName query. It is also the
+	// input handed to the next run on continue-as-new.
+	MutexState struct {
+		ResourceID   string
+		Holder       *LockHolder
+		Waiters      []LockWaiter
+		Acquisitions int
+		Paused       bool
+	}
+)
+
+// queryNow returns the time wait times are computed at. Queries do not alter
+// history, so they read the wall clock: workflow.Now is the time of the last
+// workflow task, which understates the wait on an idle mutex. The later of the
+// two is used in case the worker clock lags behind the server.
+func queryNow(ctx workflow.Context) time.Time {
+	now := time.Now()
+	if workflowNow := workflow.Now(ctx); workflowNow.After(now) {
+		return workflowNow
+	}
+	return now
+}
+
+// withWaitTimes sets the wait time of each waiter as of now.
+func withWaitTimes(waiters []LockWaiter, now time.Time) []LockWaiter {
+	for i := range waiters {
+		waiters[i].WaitTime = now.Sub(waiters[i].EnqueuedAt)
+	}
+	return waiters
+}
+
+func (q *queuedMutex) registerHandlers(ctx workflow.Context) error {
+	if err := workflow.SetQueryHandler(ctx, HolderQueryName, func() (*LockHolder, error) {
+		return q.holder, nil
+	}); err != nil {
+		return err
+	}
+	if err := workflow.SetQueryHandler(ctx, WaitersQueryName, func() ([]LockWaiter, error) {
+		return withWaitTimes(q.waiters(), queryNow(ctx)), nil
+	}); err != nil {
+		return err
+	}
+	if err := workflow.SetQueryHandler(ctx, AcquisitionsQueryName, func() (int, error) {
+		return q.acquisitions, nil
+	}); err != nil {
+		return err
+	}
+	if err := workflow.SetQueryHandler(ctx, StateQueryName, func() (MutexState, error) {
+		state := q.snapshot()
+		state.Waiters = withWaitTimes(state.Waiters, queryNow(ctx))
+		return state, nil
+	}); err != nil {
+		return err
+	}
+
+	if err := workflow.SetUpdateHandlerWithOptions(ctx, ForceReleaseUpdateName,
+		func(ctx workflow.Context) (string, error) {
+			q.releaseReason = releasedByAdmin
+			return q.holder.WorkflowID, nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context) error {
+				if q.holder == nil {
+					return fmt.Errorf("lock on %s is not held", q.resourceID)
+				}
+				return nil
+			},
+		}); err != nil {
+		return err
+	}
+	if err := workflow.SetUpdateHandlerWithOptions(ctx, EvictWaiterUpdateName,
+		func(ctx workflow.Context, workflowID string) error {
+			q.evicted[workflowID] = true
+			return nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, workflowID string) error {
+				if q.holder != nil && q.holder.WorkflowID == workflowID {
+					return fmt.Errorf("%s holds the lock, use %s instead", workflowID, ForceReleaseUpdateName)
+				}
+				if !slices.ContainsFunc(q.queue, func(w LockWaiter) bool { return w.WorkflowID == workflowID }) {
+					return fmt.Errorf("%s is not waiting for %s", workflowID, q.resourceID)
+				}
+				return nil
+			},
+		}); err != nil {
+		return err
+	}
+	if err := workflow.SetUpdateHandler(ctx, PauseUpdateName, func(ctx workflow.Context) (bool, error) {
+		changed := !q.paused
+		q.paused = true
+		return changed, nil
+	}); err != nil {
+		return err
+	}
+	return workflow.SetUpdateHandler(ctx, ResumeUpdateName, func(ctx workflow.Context) (bool, error) {
+		changed := q.paused
+		q.paused = false
+		return changed, nil
+	})
+}
+
+func (q *queuedMutex) snapshot() MutexState {
+	return MutexState{
+		ResourceID:   q.resourceID,
+		Holder:       q.holder,
+		Waiters:      q.waiters(),
+		Acquisitions: q.acquisitions,
+		Paused:       q.paused,
+	}
+}
+
+// waiters returns the queued workflows in the order they will be granted the lock.
+func (q *queuedMutex) waiters() []LockWaiter {
+	return slices.Clone(q.queue)
+}
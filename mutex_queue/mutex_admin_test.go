@@ -0,0 +1,126 @@
+package mutex_queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+// updateResult is the outcome of an update sent through the test environment,
+// known once the workflow processed it.
+type updateResult struct {
+	rejected error
+	result   interface{}
+	err      error
+}
+
+func sendUpdate(env *testsuite.TestWorkflowEnvironment, name string, args ...interface{}) *updateResult {
+	result := &updateResult{}
+	env.UpdateWorkflow(name, uuid.NewString(), &testsuite.TestUpdateCallback{
+		OnAccept:   func() {},
+		OnReject:   func(err error) { result.rejected = err },
+		OnComplete: func(r interface{}, err error) { result.result, result.err = r, err },
+	}, args...)
+	return result
+}
+
+func query[T any](t *testing.T, env *testsuite.TestWorkflowEnvironment, name string) T {
+	encoded, err := env.QueryWorkflow(name)
+	require.NoError(t, err)
+	var result T
+	require.NoError(t, encoded.Get(&result))
+	return result
+}
+
+func Test_MutexWorkflow_AdminQueriesAndUpdates(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	for _, id := range []string{"A", "B", "D"} {
+		env.OnSignalExternalWorkflow(mock.Anything, id, "", acquireLockSignalName("resource"), "unlock-event-"+id).Return(nil).Once()
+	}
+	env.OnRequestCancelExternalWorkflow(mock.Anything, "C", "").Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "A"})
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "B"})
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "C"})
+	}, 2*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "D"})
+	}, 3*time.Second)
+
+	var evictHolder, evictUnknown, evict, pause, pauseAgain, release, releaseFree, resume *updateResult
+	env.RegisterDelayedCallback(func() {
+		holder := query[*LockHolder](t, env, HolderQueryName)
+		require.Equal(t, "A", holder.WorkflowID)
+		require.Equal(t, "unlock-event-A", holder.ReleaseChannelName)
+		require.Equal(t, 1, query[int](t, env, AcquisitionsQueryName))
+
+		waiters := query[[]LockWaiter](t, env, WaitersQueryName)
+		require.Equal(t, []string{"B", "C", "D"}, waiterIDs(waiters))
+		require.Equal(t, []time.Duration{3 * time.Second, 3 * time.Second, 2 * time.Second},
+			[]time.Duration{waiters[0].WaitTime, waiters[1].WaitTime, waiters[2].WaitTime})
+
+		evictHolder = sendUpdate(env, EvictWaiterUpdateName, "A")
+		evictUnknown = sendUpdate(env, EvictWaiterUpdateName, "X")
+		evict = sendUpdate(env, EvictWaiterUpdateName, "C")
+	}, 5*time.Second)
+
+	env.RegisterDelayedCallback(func() {
+		require.Error(t, evictHolder.rejected, "the holder is not a waiter")
+		require.Error(t, evictUnknown.rejected, "X is not queued")
+		require.NoError(t, evict.rejected)
+		require.NoError(t, evict.err)
+		require.Equal(t, []string{"B", "D"}, waiterIDs(query[[]LockWaiter](t, env, WaitersQueryName)))
+
+		pause = sendUpdate(env, PauseUpdateName)
+		pauseAgain = sendUpdate(env, PauseUpdateName)
+		release = sendUpdate(env, ForceReleaseUpdateName)
+	}, 6*time.Second)
+
+	env.RegisterDelayedCallback(func() {
+		require.NoError(t, pause.err)
+		require.Equal(t, true, pause.result)
+		require.Equal(t, false, pauseAgain.result, "already paused")
+		require.NoError(t, release.err)
+		require.Equal(t, "A", release.result)
+
+		// Paused, the released lock is not granted to B.
+		state := query[MutexState](t, env, StateQueryName)
+		require.Nil(t, state.Holder)
+		require.True(t, state.Paused)
+		require.Equal(t, []string{"B", "D"}, waiterIDs(state.Waiters))
+		require.Equal(t, 5*time.Second, state.Waiters[0].WaitTime)
+
+		releaseFree = sendUpdate(env, ForceReleaseUpdateName)
+		resume = sendUpdate(env, ResumeUpdateName)
+	}, 7*time.Second)
+
+	env.RegisterDelayedCallback(func() {
+		require.Error(t, releaseFree.rejected, "the lock is not held")
+		require.NoError(t, resume.err)
+		require.Equal(t, true, resume.result)
+
+		state := query[MutexState](t, env, StateQueryName)
+		require.Equal(t, "B", state.Holder.WorkflowID)
+		require.False(t, state.Paused)
+		require.Equal(t, 2, state.Acquisitions)
+		require.Equal(t, []string{"D"}, waiterIDs(state.Waiters))
+		env.SignalWorkflow("unlock-event-B", "B")
+	}, 8*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-D", "D")
+	}, 9*time.Second)
+
+	env.ExecuteWorkflow(MutexWorkflowWithCancellation, "ns", "resource", time.Minute, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	env.AssertExpectations(t)
+}
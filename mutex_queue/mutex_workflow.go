@@ -1,6 +1,7 @@
 package mutex_queue
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"time"
@@ -9,26 +10,81 @@ import (
 )
 
 const (
-	// AcquireLockSignalName signal channel name for lock acquisition
+	// AcquireLockSignalName prefixes the signal channel name for lock acquisition,
+	// see acquireLockSignalName
 	AcquireLockSignalName = "acquire-lock-event"
 	// RequestLockSignalName channel name for request lock
 	RequestLockSignalName = "request-lock-event"
+	// LockRejectedSignalName prefixes the signal channel name for requests whose
+	// deadline passed, see lockRejectedSignalName
+	LockRejectedSignalName = "lock-rejected-event"
+	// WithdrawLockSignalName channel name for withdrawing a request or releasing a held lock
+	WithdrawLockSignalName = "withdraw-lock-event"
 )
 
+// acquireLockSignalName is the channel a grant of resourceID is signaled on. A
+// channel per resource keeps a late grant of one resource from being taken for
+// the grant of another by a workflow that locks several.
+func acquireLockSignalName(resourceID string) string {
+	return AcquireLockSignalName + ":" + resourceID
+}
+
+// lockRejectedSignalName is the channel a rejection of a request for resourceID
+// is signaled on.
+func lockRejectedSignalName(resourceID string) string {
+	return LockRejectedSignalName + ":" + resourceID
+}
+
+// Reasons a held lock is released, reported by the mutex_forced_releases metric.
+const (
+	releasedByHolder    = "released"
+	releasedByAdmin     = "force_release"
+	releasedOnTimeout   = "unlock_timeout"
+	releasedUnreachable = "holder_unreachable"
+)
+
+// LockRequest is the payload of RequestLockSignalName.
+type LockRequest struct {
+	WorkflowID string
+	// Priority orders the queue, higher values are granted first. Requests of
+	// equal priority are granted in arrival order.
+	Priority int
+	// Deadline rejects the request if the lock is not granted by then. The zero
+	// value waits indefinitely.
+	Deadline time.Time
+	// TraceContext carries the requester's span, see NewTracingInterceptor.
+	TraceContext map[string]string `json:",omitempty"`
+}
+
 type queuedMutex struct {
-	queue         []string
+	lockNamespace string
+	resourceID    string
+	queue         []LockWaiter
+	evicted       map[string]bool
+	withdrawn     map[string]bool
 	unlockTimeout time.Duration
+
+	holder        *LockHolder
+	releaseReason string
+	acquisitions  int
+	paused        bool
+
+	// draining stops new grants while the workflow prepares to continue as new,
+	// inflight counts senders in the middle of being signaled or cancelled.
+	draining bool
+	inflight int
 }
 
+// MutexWorkflowWithCancellation serializes access to resourceID. state is nil on
+// the first run and carries the holder and waiters across continue-as-new.
 func MutexWorkflowWithCancellation(
 	ctx workflow.Context,
 	namespace string,
 	resourceID string,
 	unlockTimeout time.Duration,
-	queue []string,
+	state *MutexState,
 ) error {
 	logger := workflow.GetLogger(ctx)
-	info := workflow.GetInfo(ctx)
 	currentWorkflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
 	if currentWorkflowID == "default-test-workflow-id" {
 		// unit testing hack, see https://github.com/uber-go/cadence-client/issues/663
@@ -37,11 +93,19 @@ func MutexWorkflowWithCancellation(
 	logger.Info("started", "currentWorkflowID", currentWorkflowID)
 
 	requestLockCh := workflow.GetSignalChannel(ctx, RequestLockSignalName)
+	withdrawLockCh := workflow.GetSignalChannel(ctx, WithdrawLockSignalName)
 	completeCh := workflow.NewChannel(ctx)
 	q := &queuedMutex{
-		queue:         queue,
+		lockNamespace: namespace,
+		resourceID:    resourceID,
+		evicted:       make(map[string]bool),
+		withdrawn:     make(map[string]bool),
 		unlockTimeout: unlockTimeout,
 	}
+	if err := q.registerHandlers(ctx); err != nil {
+		return err
+	}
+	q.restore(ctx, state, completeCh)
 	done := false
 
 	for {
@@ -50,13 +114,17 @@ func MutexWorkflowWithCancellation(
 			c.Receive(ctx, &done)
 		})
 		selector.AddReceive(requestLockCh, func(c workflow.ReceiveChannel, more bool) {
+			var request LockRequest
+			c.Receive(ctx, &request)
+			q.enqueue(ctx, LockWaiter{LockRequest: request, EnqueuedAt: workflow.Now(ctx)}, completeCh)
+		})
+		selector.AddReceive(withdrawLockCh, func(c workflow.ReceiveChannel, more bool) {
 			var senderID string
 			c.Receive(ctx, &senderID)
-			q.queue = append(q.queue, senderID)
-			workflow.Go(ctx, q.processSender(ctx, senderID, completeCh))
+			q.withdraw(senderID)
 		})
-		if info.GetContinueAsNewSuggested() {
-			return workflow.NewContinueAsNewError(ctx, MutexWorkflowWithCancellation, namespace, resourceID, unlockTimeout, queue)
+		if workflow.GetInfo(ctx).GetContinueAsNewSuggested() {
+			return q.continueAsNew(ctx, namespace, requestLockCh, withdrawLockCh, completeCh)
 		}
 		if done && requestLockCh.Len() == 0 {
 			return nil
@@ -65,27 +133,178 @@ func MutexWorkflowWithCancellation(
 	}
 }
 
-func (q *queuedMutex) processSender(ctx workflow.Context, senderID string, completeCh workflow.Channel) func(workflow.Context) {
-	return func(ctx workflow.Context) {
-		var index int
-		workflow.Await(ctx, func() bool {
-			index = slices.Index(q.queue, senderID)
-			isLast := index == len(q.queue)-1
-			// Block the last element in the queue unless it's the only one left.
-			return !isLast || len(q.queue) == 1
+// enqueue inserts the waiter behind every waiter of equal or higher priority.
+func (q *queuedMutex) enqueue(ctx workflow.Context, waiter LockWaiter, completeCh workflow.Channel) {
+	index := slices.IndexFunc(q.queue, func(w LockWaiter) bool {
+		return w.Priority < waiter.Priority
+	})
+	if index < 0 {
+		index = len(q.queue)
+	}
+	q.queue = slices.Insert(q.queue, index, waiter)
+	q.recordQueueDepth(ctx)
+	workflow.Go(ctx, q.processSender(ctx, waiter, completeCh))
+}
+
+// withdraw drops a request the sender no longer wants, or releases the lock if
+// it has already been granted.
+func (q *queuedMutex) withdraw(senderID string) {
+	if q.holder != nil && q.holder.WorkflowID == senderID {
+		q.releaseReason = releasedByHolder
+		return
+	}
+	if slices.ContainsFunc(q.queue, func(w LockWaiter) bool { return w.WorkflowID == senderID }) {
+		q.withdrawn[senderID] = true
+	}
+}
+
+// restore rebuilds the queue handed over by a previous run. The holder keeps
+// its release channel and the remainder of its unlock timeout.
+func (q *queuedMutex) restore(ctx workflow.Context, state *MutexState, completeCh workflow.Channel) {
+	if state == nil {
+		return
+	}
+	q.acquisitions = state.Acquisitions
+	q.paused = state.Paused
+	if state.Holder != nil {
+		q.holder = state.Holder
+		workflow.Go(ctx, func(ctx workflow.Context) {
+			q.awaitRelease(ctx)
+			q.tryComplete(ctx, completeCh)
 		})
-		if index == 0 {
-			unblockSender(ctx, senderID, q.unlockTimeout)
+	}
+	for _, waiter := range state.Waiters {
+		q.enqueue(ctx, waiter, completeCh)
+	}
+}
+
+// continueAsNew stops granting, drains buffered lock requests, waits for
+// in-flight signals and cancellations to settle and hands the queue to a new run.
+func (q *queuedMutex) continueAsNew(ctx workflow.Context, namespace string,
+	requestLockCh, withdrawLockCh workflow.ReceiveChannel, completeCh workflow.Channel) error {
+	q.draining = true
+	// Requests can keep arriving while waiting for the queue to settle, so
+	// repeat until nothing is buffered once it has.
+	for {
+		var request LockRequest
+		for requestLockCh.ReceiveAsync(&request) {
+			q.enqueue(ctx, LockWaiter{LockRequest: request, EnqueuedAt: workflow.Now(ctx)}, completeCh)
+		}
+		var senderID string
+		for withdrawLockCh.ReceiveAsync(&senderID) {
+			q.withdraw(senderID)
+		}
+		_ = workflow.Await(ctx, func() bool {
+			return q.settled() && workflow.AllHandlersFinished(ctx)
+		})
+		if requestLockCh.Len() == 0 && withdrawLockCh.Len() == 0 {
+			break
+		}
+	}
+
+	state := q.snapshot()
+	// A release that arrived while draining has not been picked up by the holder yet.
+	if state.Holder != nil && (q.releaseReason != "" ||
+		workflow.GetSignalChannel(ctx, state.Holder.ReleaseChannelName).ReceiveAsync(nil)) {
+		state.Holder = nil
+	}
+	if state.Holder == nil && len(state.Waiters) == 0 {
+		return nil
+	}
+	workflow.GetLogger(ctx).Info("continuing as new", "waiters", len(state.Waiters), "holder", state.Holder)
+	return workflow.NewContinueAsNewError(ctx, MutexWorkflowWithCancellation, namespace, q.resourceID, q.unlockTimeout, &state)
+}
+
+// processSender waits until the sender reaches the head of the queue and the
+// lock is free, then grants it. Evicted senders are cancelled, senders whose
+// deadline passes first are rejected and withdrawn requests are dropped.
+func (q *queuedMutex) processSender(ctx workflow.Context, waiter LockWaiter, completeCh workflow.Channel) func(workflow.Context) {
+	return func(ctx workflow.Context) {
+		logger := workflow.GetLogger(ctx)
+		senderID := waiter.WorkflowID
+		ready := func() bool {
+			return q.ready(senderID)
+		}
+		granted := true
+		if waiter.Deadline.IsZero() {
+			_ = workflow.Await(ctx, ready)
 		} else {
-			cancelSender(ctx, senderID)
+			granted, _ = workflow.AwaitWithTimeout(ctx, waiter.Deadline.Sub(workflow.Now(ctx)), ready)
 		}
-		// Remove the unblocked or cancelled sender
-		index = slices.Index(q.queue, senderID) // reindex is needed since other coroutine could have updated the queue
-		q.queue = append(q.queue[:index], q.queue[index+1:]...)
-		// Try to complete if queue is empty
-		if len(q.queue) == 0 {
-			completeCh.Send(ctx, true)
+		withdrawn, evicted := q.withdrawn[senderID], q.evicted[senderID]
+
+		q.inflight++
+		q.dequeue(ctx, senderID)
+		spanCtx, finishSpan := startRequestSpan(ctx, "MutexWait", q.resourceID, senderID, waiter.TraceContext, waiter.EnqueuedAt)
+		switch {
+		case withdrawn:
+			logger.Info("lock request withdrawn", "sender", senderID)
+			q.recordCancelled(ctx, "withdrawn")
+			finishSpan(errors.New("lock request withdrawn"))
+		case evicted:
+			cancelSender(spanCtx, senderID)
+			q.recordCancelled(ctx, "evicted")
+			finishSpan(errors.New("lock request evicted"))
+		case !granted:
+			logger.Info("lock request deadline passed", "sender", senderID, "deadline", waiter.Deadline)
+			q.rejectSender(spanCtx, senderID)
+			q.recordCancelled(ctx, "deadline")
+			finishSpan(errors.New("lock request deadline passed"))
+		default:
+			q.recordGranted(ctx, waiter)
+			q.grantLock(spanCtx, waiter)
+			finishSpan(nil)
+			q.inflight--
+			q.awaitRelease(ctx)
+			q.tryComplete(ctx, completeCh)
+			return
 		}
+		q.inflight--
+		q.tryComplete(ctx, completeCh)
+	}
+}
+
+// ready reports whether senderID can stop waiting, either to be granted the
+// lock at the head of the queue or to be dropped after eviction or withdrawal.
+func (q *queuedMutex) ready(senderID string) bool {
+	if q.evicted[senderID] || q.withdrawn[senderID] {
+		return true
+	}
+	// Hold the head of the queue back while the lock is held or granting is paused.
+	if q.holder != nil || q.paused || q.draining || len(q.queue) == 0 {
+		return false
+	}
+	return q.queue[0].WorkflowID == senderID
+}
+
+// settled reports whether every queued sender is blocked waiting for the lock,
+// so the queue can be handed over as is.
+func (q *queuedMutex) settled() bool {
+	if q.inflight > 0 {
+		return false
+	}
+	for _, waiter := range q.queue {
+		if q.ready(waiter.WorkflowID) {
+			return false
+		}
+	}
+	return true
+}
+
+// dequeue drops senderID from the wait queue.
+func (q *queuedMutex) dequeue(ctx workflow.Context, senderID string) {
+	q.queue = slices.DeleteFunc(q.queue, func(w LockWaiter) bool {
+		return w.WorkflowID == senderID
+	})
+	q.recordQueueDepth(ctx)
+	delete(q.evicted, senderID)
+	delete(q.withdrawn, senderID)
+}
+
+// tryComplete completes the workflow if the lock is free and nobody is queued.
+func (q *queuedMutex) tryComplete(ctx workflow.Context, completeCh workflow.Channel) {
+	if q.holder == nil && len(q.queue) == 0 {
+		completeCh.Send(ctx, true)
 	}
 }
 
@@ -97,27 +316,77 @@ func cancelSender(ctx workflow.Context, senderWorkflowID string) {
 	}
 }
 
-func unblockSender(ctx workflow.Context, senderWorkflowID string, unlockTimeout time.Duration) {
+func (q *queuedMutex) rejectSender(ctx workflow.Context, senderWorkflowID string) {
+	err := workflow.SignalExternalWorkflow(ctx, senderWorkflowID, "", lockRejectedSignalName(q.resourceID), q.resourceID).Get(ctx, nil)
+	if err != nil {
+		workflow.GetLogger(ctx).Info("SignalExternalWorkflow error", "Error", err)
+	}
+}
+
+func (q *queuedMutex) grantLock(ctx workflow.Context, waiter LockWaiter) {
 	logger := workflow.GetLogger(ctx)
+	senderWorkflowID := waiter.WorkflowID
+	// Claim the lock before yielding so that no other waiter is granted it.
+	q.holder = &LockHolder{
+		WorkflowID:   senderWorkflowID,
+		AcquiredAt:   workflow.Now(ctx),
+		TraceContext: waiter.TraceContext,
+	}
+	q.releaseReason = ""
+	q.acquisitions++
+
 	var releaseLockChannelName string
 	_ = workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
 		return generateUnlockChannelName(senderWorkflowID)
 	}).Get(&releaseLockChannelName)
 	logger.Info("generated release lock channel name", "releaseLockChannelName", releaseLockChannelName)
+	q.holder.ReleaseChannelName = releaseLockChannelName
 	// Send release lock channel name back to a senderWorkflowID, so that it can
 	// release the lock using release lock channel name
-	err := workflow.SignalExternalWorkflow(ctx, senderWorkflowID, "", AcquireLockSignalName, releaseLockChannelName).Get(ctx, nil)
+	err := workflow.SignalExternalWorkflow(ctx, senderWorkflowID, "", acquireLockSignalName(q.resourceID), releaseLockChannelName).Get(ctx, nil)
 	if err != nil {
 		// .Get(ctx, nil) blocks until the signal is sent.
 		// If the senderWorkflowID is closed (terminated/canceled/timeouted/completed/etc), this would return error.
 		// In this case we release the lock immediately instead of failing the mutex workflow.
 		// Mutex workflow failing would lead to all workflows that have sent requestLock will be waiting.
 		logger.Info("SignalExternalWorkflow error", "Error", err)
+		q.releaseReason = releasedUnreachable
+		return
 	}
 	logger.Info("signaled external workflow")
+}
+
+// awaitRelease blocks until the holder signals its release channel, the lock
+// is force released or the unlock timeout measured from acquisition expires.
+func (q *queuedMutex) awaitRelease(ctx workflow.Context) {
+	logger := workflow.GetLogger(ctx)
+	holder := q.holder
+	defer func() { q.holder = nil }()
+
 	var ack string
-	workflow.GetSignalChannel(ctx, releaseLockChannelName).ReceiveWithTimeout(ctx, unlockTimeout, &ack)
-	logger.Info("release signal received: " + ack)
+	releaseCh := workflow.GetSignalChannel(ctx, holder.ReleaseChannelName)
+	remaining := q.unlockTimeout - workflow.Now(ctx).Sub(holder.AcquiredAt)
+	_, _ = workflow.AwaitWithTimeout(ctx, remaining, func() bool {
+		return releaseCh.Len() > 0 || q.releaseReason != ""
+	})
+	reason := q.releaseReason
+	if releaseCh.ReceiveAsync(&ack) {
+		logger.Info("release signal received: " + ack)
+		reason = releasedByHolder
+	} else if reason != "" {
+		logger.Info("lock force released", "holder", holder.WorkflowID, "reason", reason)
+	} else {
+		logger.Info("unlock timeout reached", "holder", holder.WorkflowID)
+		reason = releasedOnTimeout
+	}
+	q.recordReleased(ctx, holder, reason)
+
+	_, finishSpan := startRequestSpan(ctx, "MutexHold", q.resourceID, holder.WorkflowID, holder.TraceContext, holder.AcquiredAt)
+	if reason == releasedByHolder {
+		finishSpan(nil)
+	} else {
+		finishSpan(fmt.Errorf("lock released: %s", reason))
+	}
 }
 
 // generateUnlockChannelName generates release lock channel name
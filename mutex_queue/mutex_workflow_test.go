@@ -0,0 +1,143 @@
+package mutex_queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func Test_MutexWorkflow_ContinueAsNewCarriesQueue(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+
+	// First run: A holds the lock, B waits, then continue-as-new is suggested
+	// while C and D are being signaled. D is still buffered when the workflow
+	// decides to continue as new and must not be lost.
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.OnSignalExternalWorkflow(mock.Anything, "A", "", acquireLockSignalName("resource"), "unlock-event-A").Return(nil).Once()
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "A"})
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "B"})
+	}, 2*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SetContinueAsNewSuggested(true)
+		// Deliver both signals in the same workflow task.
+		env.SignalWorkflowSkippingWorkflowTask(RequestLockSignalName, LockRequest{WorkflowID: "C"})
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "D"})
+	}, 3*time.Second)
+
+	env.ExecuteWorkflow(MutexWorkflowWithCancellation, "ns", "resource", time.Minute, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var canErr *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &canErr))
+	env.AssertExpectations(t)
+
+	var namespace, resourceID string
+	var unlockTimeout time.Duration
+	var state *MutexState
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(canErr.Input,
+		&namespace, &resourceID, &unlockTimeout, &state))
+	require.Equal(t, "resource", resourceID)
+	require.Equal(t, time.Minute, unlockTimeout)
+	require.NotNil(t, state.Holder)
+	require.Equal(t, "A", state.Holder.WorkflowID)
+	require.Equal(t, "unlock-event-A", state.Holder.ReleaseChannelName)
+	require.Equal(t, 1, state.Acquisitions)
+	require.Equal(t, []string{"B", "C", "D"}, waiterIDs(state.Waiters))
+
+	// Second run: A releases through the carried channel and the lock is
+	// handed to the carried waiters in order until the queue is empty.
+	env = testSuite.NewTestWorkflowEnvironment()
+	for _, id := range []string{"B", "C", "D"} {
+		env.OnSignalExternalWorkflow(mock.Anything, id, "", acquireLockSignalName("resource"), "unlock-event-"+id).Return(nil).Once()
+	}
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-A", "A")
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		current := queryState(t, env)
+		require.NotNil(t, current.Holder)
+		require.Equal(t, "B", current.Holder.WorkflowID)
+		require.Equal(t, []string{"C", "D"}, waiterIDs(current.Waiters))
+		require.Equal(t, 2, current.Acquisitions)
+
+		env.SignalWorkflow("unlock-event-B", "B")
+	}, 2*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-C", "C")
+	}, 3*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-D", "D")
+	}, 4*time.Second)
+
+	env.ExecuteWorkflow(MutexWorkflowWithCancellation, namespace, resourceID, unlockTimeout, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	env.AssertExpectations(t)
+}
+
+func Test_MutexWorkflow_PriorityAndDeadline(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	for _, id := range []string{"A", "C", "B"} {
+		env.OnSignalExternalWorkflow(mock.Anything, id, "", acquireLockSignalName("resource"), "unlock-event-"+id).Return(nil).Once()
+	}
+	// D outranks B but is rejected when its deadline passes before A releases the lock.
+	env.OnSignalExternalWorkflow(mock.Anything, "D", "", lockRejectedSignalName("resource"), "resource").Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "A"})
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "B"})
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "C", Priority: 5})
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "D", Priority: 1, Deadline: env.Now().Add(5 * time.Second)})
+	}, 2*time.Second)
+	env.RegisterDelayedCallback(func() {
+		require.Equal(t, []string{"C", "D", "B"}, waiterIDs(queryState(t, env).Waiters))
+	}, 3*time.Second)
+	env.RegisterDelayedCallback(func() {
+		require.Equal(t, []string{"C", "B"}, waiterIDs(queryState(t, env).Waiters))
+		env.SignalWorkflow("unlock-event-A", "A")
+	}, 10*time.Second)
+	env.RegisterDelayedCallback(func() {
+		current := queryState(t, env)
+		require.Equal(t, "C", current.Holder.WorkflowID)
+		require.Equal(t, []string{"B"}, waiterIDs(current.Waiters))
+		env.SignalWorkflow("unlock-event-C", "C")
+	}, 11*time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-B", "B")
+	}, 12*time.Second)
+
+	env.ExecuteWorkflow(MutexWorkflowWithCancellation, "ns", "resource", time.Minute, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	env.AssertExpectations(t)
+}
+
+func queryState(t *testing.T, env *testsuite.TestWorkflowEnvironment) MutexState {
+	result, err := env.QueryWorkflow(StateQueryName)
+	require.NoError(t, err)
+	var state MutexState
+	require.NoError(t, result.Get(&state))
+	return state
+}
+
+func waiterIDs(waiters []LockWaiter) []string {
+	ids := make([]string, 0, len(waiters))
+	for _, w := range waiters {
+		ids = append(ids, w.WorkflowID)
+	}
+	return ids
+}
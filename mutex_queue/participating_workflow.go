@@ -2,7 +2,9 @@ package mutex_queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"go.temporal.io/sdk/activity"
@@ -19,12 +21,25 @@ type (
 		lockNamespace     string
 	}
 
+	// LockOptions controls where a lock request is placed in the mutex queue.
+	LockOptions struct {
+		// Priority orders waiters, higher values are granted first.
+		Priority int
+		// Deadline rejects the request if the lock has not been granted by then.
+		// The zero value waits indefinitely.
+		Deadline time.Time
+	}
+
 	ContextKey string
 )
 
 const (
 	TaskQueue                   = "mutex_queue"
 	ClientContextKey ContextKey = "Client"
+
+	// LockDeadlineExceededErrorType is the ApplicationError type returned when
+	// the lock is not granted before LockOptions.Deadline.
+	LockDeadlineExceededErrorType = "LockDeadlineExceeded"
 )
 
 // NewMutex initializes mutex
@@ -37,6 +52,15 @@ func NewMutex(currentWorkflowID string, lockNamespace string) *Mutex {
 
 func (s *Mutex) LockWithCancellation(ctx workflow.Context,
 	resourceID string, unlockTimeout time.Duration) (UnlockFunc, error) {
+	return s.LockWithOptions(ctx, resourceID, unlockTimeout, LockOptions{})
+}
+
+// LockWithOptions queues a lock request with the given priority and deadline.
+// It returns an ApplicationError of type LockDeadlineExceededErrorType if the
+// deadline passes before the lock is granted. If ctx is cancelled while
+// waiting, the request is withdrawn from the mutex queue.
+func (s *Mutex) LockWithOptions(ctx workflow.Context,
+	resourceID string, unlockTimeout time.Duration, options LockOptions) (UnlockFunc, error) {
 
 	activityCtx := workflow.WithLocalActivityOptions(ctx, workflow.LocalActivityOptions{
 		ScheduleToCloseTimeout: time.Minute,
@@ -50,32 +74,115 @@ func (s *Mutex) LockWithCancellation(ctx workflow.Context,
 
 	var releaseLockChannelName string
 	var execution workflow.Execution
+	request := LockRequest{
+		WorkflowID:   s.currentWorkflowID,
+		Priority:     options.Priority,
+		Deadline:     options.Deadline,
+		TraceContext: marshalSpan(ctx),
+	}
+	requestedAt := workflow.Now(ctx)
 	err := workflow.ExecuteLocalActivity(activityCtx, SignalWithStartMutexWorkflowActivity, s.lockNamespace,
-		resourceID, s.currentWorkflowID, unlockTimeout).Get(ctx, &execution)
+		resourceID, request, unlockTimeout).Get(ctx, &execution)
 	if err != nil {
 		return nil, err
 	}
 
-	isCanceled := false
+	isCanceled, isRejected := false, false
 	selector := workflow.NewSelector(ctx)
-	selector.AddReceive(workflow.GetSignalChannel(ctx, AcquireLockSignalName), func(c workflow.ReceiveChannel, more bool) {
+	selector.AddReceive(workflow.GetSignalChannel(ctx, acquireLockSignalName(resourceID)), func(c workflow.ReceiveChannel, more bool) {
 		c.Receive(ctx, &releaseLockChannelName)
 		workflow.GetLogger(ctx).Info("acquire lock", "lockName", releaseLockChannelName)
 	})
+	selector.AddReceive(workflow.GetSignalChannel(ctx, lockRejectedSignalName(resourceID)), func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+		isRejected = true
+		workflow.GetLogger(ctx).Info("lock request rejected", "resourceID", resourceID)
+	})
 	selector.AddReceive(ctx.Done(), func(c workflow.ReceiveChannel, more bool) {
 		isCanceled = true
 		workflow.GetLogger(ctx).Info("recieved cancel")
 	})
+	// The mutex rejects the request at the deadline, but it may never get to
+	// it, e.g. while it is not running. Enforce the deadline here as well.
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+	defer cancelTimer()
+	isTimedOut := false
+	if !options.Deadline.IsZero() {
+		timer := workflow.NewTimer(timerCtx, options.Deadline.Sub(workflow.Now(ctx)))
+		selector.AddFuture(timer, func(f workflow.Future) {
+			// The timer fails when ctx is cancelled.
+			if f.Get(ctx, nil) != nil {
+				isCanceled = true
+				return
+			}
+			isTimedOut = true
+			workflow.GetLogger(ctx).Info("lock request deadline passed", "resourceID", resourceID)
+		})
+	}
 	selector.Select(ctx)
 
-	if !isCanceled {
-		unlockFunc := func() error {
-			return workflow.SignalExternalWorkflow(ctx, execution.ID, execution.RunID,
-				releaseLockChannelName, s.currentWorkflowID).Get(ctx, nil)
+	if isCanceled || isTimedOut {
+		// Withdraw the request so that the lock is not granted to a workflow that
+		// stopped waiting for it. The mutex releases the lock if it was granted already.
+		disconnectedCtx, _ := workflow.NewDisconnectedContext(ctx)
+		err := workflow.SignalExternalWorkflow(disconnectedCtx, execution.ID, "",
+			WithdrawLockSignalName, s.currentWorkflowID).Get(disconnectedCtx, nil)
+		if err != nil {
+			workflow.GetLogger(ctx).Info("unable to withdraw lock request", "Error", err)
 		}
-		return unlockFunc, nil
 	}
-	return nil, temporal.NewCanceledError()
+	if isCanceled {
+		recordAcquireFailed(ctx, s.lockNamespace, "cancelled")
+		return nil, temporal.NewCanceledError()
+	}
+	if isRejected || isTimedOut {
+		recordAcquireFailed(ctx, s.lockNamespace, "deadline")
+		return nil, temporal.NewApplicationError(
+			fmt.Sprintf("lock on %s was not granted before the deadline", resourceID), LockDeadlineExceededErrorType)
+	}
+	recordAcquired(ctx, s.lockNamespace, requestedAt)
+
+	unlockFunc := func() error {
+		// Release through a disconnected context so that a cancelled workflow can
+		// still unlock, and signal the latest run rather than execution.RunID since
+		// the mutex workflow may have continued as new while the lock was held.
+		disconnectedCtx, _ := workflow.NewDisconnectedContext(ctx)
+		return workflow.SignalExternalWorkflow(disconnectedCtx, execution.ID, "",
+			releaseLockChannelName, s.currentWorkflowID).Get(disconnectedCtx, nil)
+	}
+	return unlockFunc, nil
+}
+
+// LockMany acquires the locks on all resourceIDs or on none of them. Locks are
+// requested one at a time in sorted order, so workflows locking overlapping
+// sets of resources always queue on the lowest shared resource first and cannot
+// deadlock. options.Deadline bounds the whole acquisition. If a lock is
+// rejected or ctx is cancelled, the locks acquired so far are released before
+// returning. The returned UnlockFunc releases every lock.
+func (s *Mutex) LockMany(ctx workflow.Context,
+	unlockTimeout time.Duration, options LockOptions, resourceIDs ...string) (UnlockFunc, error) {
+
+	resourceIDs = slices.Compact(slices.Sorted(slices.Values(resourceIDs)))
+	unlockFuncs := make([]UnlockFunc, 0, len(resourceIDs))
+	unlockAll := func() error {
+		var errs []error
+		for i := len(unlockFuncs) - 1; i >= 0; i-- {
+			errs = append(errs, unlockFuncs[i]())
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, resourceID := range resourceIDs {
+		unlockFunc, err := s.LockWithOptions(ctx, resourceID, unlockTimeout, options)
+		if err != nil {
+			if unlockErr := unlockAll(); unlockErr != nil {
+				workflow.GetLogger(ctx).Error("unable to release acquired locks", "Error", unlockErr)
+			}
+			return nil, err
+		}
+		unlockFuncs = append(unlockFuncs, unlockFunc)
+	}
+	return unlockAll, nil
 }
 
 // SignalWithStartMutexWorkflowActivity ...
@@ -83,7 +190,7 @@ func SignalWithStartMutexWorkflowActivity(
 	ctx context.Context,
 	namespace string,
 	resourceID string,
-	senderWorkflowID string,
+	request LockRequest,
 	unlockTimeout time.Duration,
 ) (*workflow.Execution, error) {
 
@@ -105,14 +212,14 @@ func SignalWithStartMutexWorkflowActivity(
 		},
 	}
 	wr, err := c.SignalWithStartWorkflow(
-		ctx, workflowID, RequestLockSignalName, senderWorkflowID,
+		ctx, workflowID, RequestLockSignalName, request,
 		workflowOptions, MutexWorkflowWithCancellation, namespace, resourceID, unlockTimeout, nil)
 
 	if err != nil {
 		activity.GetLogger(ctx).Error("Unable to signal with start workflow", "Error", err)
-	} else {
-		activity.GetLogger(ctx).Info("Signaled and started Workflow", "WorkflowID", wr.GetID(), "RunID", wr.GetRunID())
+		return nil, err
 	}
+	activity.GetLogger(ctx).Info("Signaled and started Workflow", "WorkflowID", wr.GetID(), "RunID", wr.GetRunID())
 
 	return &workflow.Execution{
 		ID:    wr.GetID(),
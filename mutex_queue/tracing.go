@@ -0,0 +1,118 @@
+package mutex_queue
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+type tracerContextKey struct{}
+
+// tracingInterceptor is the SDK tracing interceptor, plus the tracer on the
+// context of every workflow it intercepts, for the spans that cross the mutex
+// workflow.
+type tracingInterceptor struct {
+	interceptor.Interceptor
+	tracer interceptor.Tracer
+}
+
+type tracerWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	tracer interceptor.Tracer
+}
+
+// NewTracingInterceptor creates the OpenTelemetry tracing interceptor for the
+// clients of workers running mutex workflows and lock requesters. Besides the
+// usual workflow, activity and signal spans, it lets the mutex workflow record
+// the time spent in the queue and holding the lock as children of the
+// requester's span, so a trace shows requester -> mutex -> holder. Lock
+// requests are not traced across the mutex workflow without it.
+func NewTracingInterceptor(options opentelemetry.TracerOptions) (interceptor.Interceptor, error) {
+	t, err := opentelemetry.NewTracer(options)
+	if err != nil {
+		return nil, err
+	}
+	return &tracingInterceptor{Interceptor: interceptor.NewTracingInterceptor(t), tracer: t}, nil
+}
+
+func (t *tracingInterceptor) InterceptWorkflow(
+	ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor,
+) interceptor.WorkflowInboundInterceptor {
+	i := &tracerWorkflowInboundInterceptor{tracer: t.tracer}
+	i.Next = t.Interceptor.InterceptWorkflow(ctx, next)
+	return i
+}
+
+func (w *tracerWorkflowInboundInterceptor) ExecuteWorkflow(
+	ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput,
+) (interface{}, error) {
+	return w.Next.ExecuteWorkflow(workflow.WithValue(ctx, tracerContextKey{}, w.tracer), in)
+}
+
+// tracerFromContext returns the tracer of the interceptor created by
+// NewTracingInterceptor, or nil if the workflow was not intercepted by it.
+func tracerFromContext(ctx workflow.Context) interceptor.Tracer {
+	tracer, _ := ctx.Value(tracerContextKey{}).(interceptor.Tracer)
+	return tracer
+}
+
+// marshalSpan serializes the span the tracing interceptor put on ctx so the
+// mutex workflow can continue the requester's trace.
+func marshalSpan(ctx workflow.Context) map[string]string {
+	tracer := tracerFromContext(ctx)
+	if tracer == nil {
+		return nil
+	}
+	span, _ := ctx.Value(tracer.Options().SpanContextKey).(interceptor.TracerSpan)
+	if span == nil {
+		return nil
+	}
+	data, err := tracer.MarshalSpan(span)
+	if err != nil {
+		workflow.GetLogger(ctx).Warn("unable to marshal span", "Error", err)
+		return nil
+	}
+	return data
+}
+
+// startRequestSpan starts a span named operation:resourceID as a child of the
+// requester's span, beginning at start. The returned context carries the span,
+// so signals sent with it continue the trace on the receiving side. Nothing is
+// recorded while replaying or when the request was not traced.
+func startRequestSpan(ctx workflow.Context, operation, resourceID, requesterID string,
+	traceContext map[string]string, start time.Time) (workflow.Context, func(err error)) {
+	noop := func(error) {}
+	tracer := tracerFromContext(ctx)
+	if tracer == nil || len(traceContext) == 0 || workflow.IsReplaying(ctx) {
+		return ctx, noop
+	}
+	parent, err := tracer.UnmarshalSpan(traceContext)
+	if err != nil {
+		workflow.GetLogger(ctx).Warn("unable to unmarshal span", "Error", err)
+		return ctx, noop
+	}
+	info := workflow.GetInfo(ctx)
+	span, err := tracer.StartSpan(&interceptor.TracerStartSpanOptions{
+		Parent:    parent,
+		Operation: operation,
+		Name:      resourceID,
+		Time:      start,
+		Tags: map[string]string{
+			"temporalWorkflowID": info.WorkflowExecution.ID,
+			"temporalRunID":      info.WorkflowExecution.RunID,
+			"lockRequester":      requesterID,
+		},
+	})
+	if err != nil {
+		workflow.GetLogger(ctx).Warn("unable to start span", "Error", err)
+		return ctx, noop
+	}
+	ctx = workflow.WithValue(ctx, tracer.Options().SpanContextKey, span)
+	return ctx, func(err error) {
+		span.Finish(&interceptor.TracerFinishSpanOptions{Error: err})
+	}
+}
@@ -0,0 +1,67 @@
+package mutex_queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func Test_MutexWorkflow_TracesRequesterSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	propagator := propagation.TraceContext{}
+	tracingInterceptor, err := NewTracingInterceptor(opentelemetry.TracerOptions{
+		Tracer:            provider.Tracer("test"),
+		TextMapPropagator: propagator,
+	})
+	require.NoError(t, err)
+
+	// The requester's span, as marshalled by marshalSpan.
+	requesterCtx, requesterSpan := provider.Tracer("test").Start(context.Background(), "requester")
+	traceContext := map[string]string{}
+	propagator.Inject(requesterCtx, propagation.MapCarrier(traceContext))
+
+	env := (&testsuite.WorkflowTestSuite{}).NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{Interceptors: []interceptor.WorkerInterceptor{tracingInterceptor}})
+	env.OnSignalExternalWorkflow(mock.Anything, "A", "", acquireLockSignalName("resource"), "unlock-event-A").Return(nil).Once()
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(RequestLockSignalName, LockRequest{WorkflowID: "A", TraceContext: traceContext})
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("unlock-event-A", "A")
+	}, 3*time.Second)
+
+	env.ExecuteWorkflow(MutexWorkflowWithCancellation, "ns", "resource", time.Minute, nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"MutexWait:resource", "MutexHold:resource"} {
+		require.Contains(t, spans, name)
+		require.Equal(t, requesterSpan.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+}
+
+func Test_MutexWorkflow_NotTracedWithoutInterceptor(t *testing.T) {
+	env := (&testsuite.WorkflowTestSuite{}).NewTestWorkflowEnvironment()
+	env.ExecuteWorkflow(func(ctx workflow.Context) (bool, error) {
+		return tracerFromContext(ctx) == nil && marshalSpan(ctx) == nil, nil
+	})
+	var untraced bool
+	require.NoError(t, env.GetWorkflowResult(&untraced))
+	require.True(t, untraced)
+}
@@ -3,17 +3,54 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 
+	"github.com/uber-go/tally/v4/prometheus"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/worker"
 
+	"github.com/taonic/my-samples-go/lib"
+	"github.com/taonic/my-samples-go/lib/health"
 	mutex "github.com/taonic/my-samples-go/mutex_queue"
+	otelworkflow "github.com/taonic/my-samples-go/opentelemetry"
 )
 
 func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tp, err := otelworkflow.InitializeGlobalTracerProvider()
+	if err != nil {
+		log.Fatalln("Unable to create a global trace provider", err)
+	}
+	defer func() {
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Println("Error shutting down trace provider:", err)
+		}
+	}()
+
+	tracingInterceptor, err := mutex.NewTracingInterceptor(opentelemetry.TracerOptions{})
+	if err != nil {
+		log.Fatalln("Unable to create interceptor", err)
+	}
+
+	// Serve /livez and /readyz to Kubernetes probes.
+	h := health.New(health.Options{})
+	go func() {
+		log.Println("Health endpoint stopped:", http.ListenAndServe("0.0.0.0:8080", h.Handler()))
+	}()
+
 	// The client and worker are heavyweight objects that should be created once per process.
 	c, err := client.Dial(client.Options{
-		HostPort: client.DefaultHostPort,
+		HostPort:     client.DefaultHostPort,
+		Interceptors: []interceptor.ClientInterceptor{tracingInterceptor},
+		MetricsHandler: h.MetricsHandler(sdktally.NewMetricsHandler(lib.NewPrometheusScope(prometheus.Configuration{
+			ListenAddress: "0.0.0.0:9090",
+			TimerType:     "histogram",
+		}))),
 	})
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
@@ -22,13 +59,14 @@ func main() {
 
 	w := worker.New(c, mutex.TaskQueue, worker.Options{
 		BackgroundActivityContext: context.WithValue(context.Background(), mutex.ClientContextKey, c),
+		OnFatalError:              h.OnFatalError,
 	})
 
 	w.RegisterActivity(mutex.SignalWithStartMutexWorkflowActivity)
 	w.RegisterWorkflow(mutex.MutexWorkflowWithCancellation)
 	w.RegisterWorkflow(mutex.SampleWorkflowWithMutex)
 
-	err = w.Run(worker.InterruptCh())
+	err = h.Run(c, w, worker.InterruptCh())
 	if err != nil {
 		log.Fatalln("Unable to start worker", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"go.temporal.io/sdk/worker"
 	"google.golang.org/grpc"
 
+	"github.com/taonic/my-samples-go/lib/health"
 	metrics "github.com/taonic/my-samples-go/otlpmetrics"
 )
 
@@ -43,12 +45,18 @@ func main() {
 		metric.WithReader(metric.NewPeriodicReader(exp, metric.WithInterval(10*time.Second))),
 		metric.WithView(prefixMetric),
 	)
+	// Serve /livez and /readyz to Kubernetes probes.
+	h := health.New(health.Options{})
+	go func() {
+		log.Println("Health endpoint stopped:", http.ListenAndServe("0.0.0.0:8080", h.Handler()))
+	}()
+
 	c, err := client.Dial(client.Options{
-		MetricsHandler: opentelemetry.NewMetricsHandler(
+		MetricsHandler: h.MetricsHandler(opentelemetry.NewMetricsHandler(
 			opentelemetry.MetricsHandlerOptions{
 				Meter: meterProvider.Meter("temporal-sdk-go"),
 			},
-		),
+		)),
 	})
 
 	if err != nil {
@@ -56,12 +64,12 @@ func main() {
 	}
 	defer c.Close()
 
-	w := worker.New(c, "metrics", worker.Options{})
+	w := worker.New(c, "metrics", worker.Options{OnFatalError: h.OnFatalError})
 
 	w.RegisterWorkflow(metrics.Workflow)
 	w.RegisterActivity(metrics.Activity)
 
-	err = w.Run(worker.InterruptCh())
+	err = h.Run(c, w, worker.InterruptCh())
 	if err != nil {
 		log.Fatalln("Unable to start worker", err)
 	}
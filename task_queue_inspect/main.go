@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+)
+
+func main() {
+	var (
+		hostPort  string
+		namespace string
+		taskQueue string
+		watch     time.Duration
+	)
+	flag.StringVar(&hostPort, "target-host", client.DefaultHostPort, "Host:port for the server.")
+	flag.StringVar(&namespace, "namespace", client.DefaultNamespace, "Namespace of the task queue.")
+	flag.StringVar(&taskQueue, "task-queue", "", "Task queue to describe.")
+	flag.DurationVar(&watch, "watch", 0, "Refresh the tables at this interval, with the change of each backlog. Describes once when 0.")
+	flag.Parse()
+	if taskQueue == "" {
+		log.Fatalln("-task-queue is required")
+	}
+
+	// The client is a heavyweight object that should be created once per process.
+	c, err := client.Dial(client.Options{
+		HostPort:  hostPort,
+		Namespace: namespace,
+	})
+	if err != nil {
+		log.Fatalln("Unable to create client", err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	if watch <= 0 {
+		description, err := describe(ctx, c, taskQueue)
+		if err != nil {
+			log.Fatalln("Unable to describe task queue", err)
+		}
+		if err := render(os.Stdout, taskQueue, description, nil, time.Now()); err != nil {
+			log.Fatalln("Unable to render task queue", err)
+		}
+		return
+	}
+
+	interruptCh := worker.InterruptCh()
+	ticker := time.NewTicker(watch)
+	defer ticker.Stop()
+	// No change is shown until a previous description exists.
+	var previous map[backlogKey]int64
+	for {
+		description, err := describe(ctx, c, taskQueue)
+		// Clear the terminal, then redraw.
+		fmt.Print("\033[H\033[2J")
+		if err != nil {
+			fmt.Println("Unable to describe task queue:", err)
+		} else if err := render(os.Stdout, taskQueue, description, previous, time.Now()); err != nil {
+			log.Fatalln("Unable to render task queue", err)
+		} else {
+			previous = backlogs(description)
+		}
+		select {
+		case <-interruptCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// describe reports the pollers and the backlog stats of every type of every
+// active build ID of the task queue, versioned or not. Servers older than 1.24
+// reject the request without saying why, so the error says so.
+func describe(ctx context.Context, c client.Client, taskQueue string) (client.TaskQueueDescription, error) {
+	description, err := c.DescribeTaskQueueEnhanced(ctx, client.DescribeTaskQueueEnhancedOptions{
+		TaskQueue: taskQueue,
+		Versions: &client.TaskQueueVersionSelection{
+			AllActive:   true,
+			Unversioned: true,
+		},
+		TaskQueueTypes: taskQueueTypes,
+		ReportPollers:  true,
+		ReportStats:    true,
+	})
+	if err != nil {
+		return client.TaskQueueDescription{}, fmt.Errorf("%w (describing versions and stats needs Temporal server 1.24 or later, upgrade the server if it is older)", err)
+	}
+	return description, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"go.temporal.io/sdk/client"
+)
+
+// taskQueueTypes are the task queue types reported, in display order.
+var taskQueueTypes = []client.TaskQueueType{
+	client.TaskQueueTypeWorkflow,
+	client.TaskQueueTypeActivity,
+	client.TaskQueueTypeNexus,
+}
+
+func typeName(t client.TaskQueueType) string {
+	switch t {
+	case client.TaskQueueTypeWorkflow:
+		return "workflow"
+	case client.TaskQueueTypeActivity:
+		return "activity"
+	case client.TaskQueueTypeNexus:
+		return "nexus"
+	default:
+		return "unspecified"
+	}
+}
+
+// backlogKey identifies the backlog of a task queue type of a build ID.
+type backlogKey struct {
+	buildID   string
+	queueType client.TaskQueueType
+}
+
+// backlogs returns the approximate backlog of each type of each build ID.
+func backlogs(description client.TaskQueueDescription) map[backlogKey]int64 {
+	counts := map[backlogKey]int64{}
+	for buildID, version := range description.VersionsInfo {
+		for queueType, info := range version.TypesInfo {
+			if info.Stats != nil {
+				counts[backlogKey{buildID, queueType}] = info.Stats.ApproximateBacklogCount
+			}
+		}
+	}
+	return counts
+}
+
+func buildIDs(description client.TaskQueueDescription) []string {
+	ids := make([]string, 0, len(description.VersionsInfo))
+	for buildID := range description.VersionsInfo {
+		ids = append(ids, buildID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func displayBuildID(buildID string) string {
+	if buildID == "" {
+		return "(unversioned)"
+	}
+	return buildID
+}
+
+// render writes the backlog of each type of each build ID, then the pollers,
+// as tables. With previous backlogs, it adds how much each backlog changed
+// since.
+func render(w io.Writer, taskQueue string, description client.TaskQueueDescription, previous map[backlogKey]int64, now time.Time) error {
+	fmt.Fprintf(w, "Task queue %s at %s\n", taskQueue, now.Format(time.RFC3339))
+	if v := description.VersioningInfo; v != nil {
+		fmt.Fprintf(w, "Current version: %s", v.CurrentVersion)
+		if v.RampingVersion != "" {
+			fmt.Fprintf(w, ", ramping %s at %.0f%%", v.RampingVersion, v.RampingVersionPercentage)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := "BUILD ID\tTYPE\tBACKLOG\tBACKLOG AGE\tADD RATE\tDISPATCH RATE\tPOLLERS"
+	if previous != nil {
+		header += "\tCHANGE"
+	}
+	fmt.Fprintln(tw, header)
+	for _, buildID := range buildIDs(description) {
+		version := description.VersionsInfo[buildID]
+		for _, queueType := range taskQueueTypes {
+			info, ok := version.TypesInfo[queueType]
+			if !ok {
+				continue
+			}
+			stats := info.Stats
+			if stats == nil {
+				stats = &client.TaskQueueStats{}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%.1f/s\t%.1f/s\t%d",
+				displayBuildID(buildID), typeName(queueType), stats.ApproximateBacklogCount,
+				stats.ApproximateBacklogAge.Round(time.Second), stats.TasksAddRate, stats.TasksDispatchRate,
+				len(info.Pollers))
+			if previous != nil {
+				fmt.Fprintf(tw, "\t%+d", stats.ApproximateBacklogCount-previous[backlogKey{buildID, queueType}])
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "POLLER IDENTITY\tTYPE\tBUILD ID\tLAST ACCESS\tRATE/S")
+	for _, buildID := range buildIDs(description) {
+		version := description.VersionsInfo[buildID]
+		for _, queueType := range taskQueueTypes {
+			pollers := append([]client.TaskQueuePollerInfo(nil), version.TypesInfo[queueType].Pollers...)
+			sort.Slice(pollers, func(i, j int) bool { return pollers[i].Identity < pollers[j].Identity })
+			for _, poller := range pollers {
+				lastAccess := "-"
+				if !poller.LastAccessTime.IsZero() {
+					lastAccess = now.Sub(poller.LastAccessTime).Round(time.Second).String() + " ago"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.0f\n",
+					poller.Identity, typeName(queueType), displayBuildID(buildID), lastAccess, poller.RatePerSecond)
+			}
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+)
+
+func Test_Render(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	description := client.TaskQueueDescription{
+		VersionsInfo: map[string]client.TaskQueueVersionInfo{
+			"": {TypesInfo: map[client.TaskQueueType]client.TaskQueueTypeInfo{
+				client.TaskQueueTypeWorkflow: {
+					Pollers: []client.TaskQueuePollerInfo{
+						{Identity: "worker-b", LastAccessTime: now.Add(-3 * time.Second)},
+						{Identity: "worker-a", LastAccessTime: now.Add(-time.Second)},
+					},
+					Stats: &client.TaskQueueStats{ApproximateBacklogCount: 5, ApproximateBacklogAge: 90 * time.Second},
+				},
+				client.TaskQueueTypeActivity: {
+					Stats: &client.TaskQueueStats{ApproximateBacklogCount: 120, TasksAddRate: 12.5, TasksDispatchRate: 2},
+				},
+			}},
+			"v2": {TypesInfo: map[client.TaskQueueType]client.TaskQueueTypeInfo{
+				client.TaskQueueTypeActivity: {
+					Pollers: []client.TaskQueuePollerInfo{{Identity: "worker-c", RatePerSecond: 100}},
+				},
+			}},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, render(&out, "orders", description, nil, now))
+	lines := strings.Split(out.String(), "\n")
+	require.Equal(t, "Task queue orders at 2024-01-01T12:00:00Z", lines[0])
+	require.Equal(t, []string{"BUILD", "ID", "TYPE", "BACKLOG", "BACKLOG", "AGE", "ADD", "RATE", "DISPATCH", "RATE", "POLLERS"}, strings.Fields(lines[2]))
+	require.Equal(t, []string{"(unversioned)", "workflow", "5", "1m30s", "0.0/s", "0.0/s", "2"}, strings.Fields(lines[3]))
+	require.Equal(t, []string{"(unversioned)", "activity", "120", "0s", "12.5/s", "2.0/s", "0"}, strings.Fields(lines[4]))
+	require.Equal(t, []string{"v2", "activity", "0", "0s", "0.0/s", "0.0/s", "1"}, strings.Fields(lines[5]))
+	require.Equal(t, []string{"worker-a", "workflow", "(unversioned)", "1s", "ago", "0"}, strings.Fields(lines[8]))
+	require.Equal(t, []string{"worker-b", "workflow", "(unversioned)", "3s", "ago", "0"}, strings.Fields(lines[9]))
+	require.Equal(t, []string{"worker-c", "activity", "v2", "-", "100"}, strings.Fields(lines[10]))
+
+	// Watching, each backlog is compared with the previous description.
+	previous := backlogs(description)
+	require.Equal(t, int64(120), previous[backlogKey{"", client.TaskQueueTypeActivity}])
+	activity := description.VersionsInfo[""].TypesInfo[client.TaskQueueTypeActivity]
+	activity.Stats = &client.TaskQueueStats{ApproximateBacklogCount: 100}
+	description.VersionsInfo[""].TypesInfo[client.TaskQueueTypeActivity] = activity
+
+	out.Reset()
+	require.NoError(t, render(&out, "orders", description, previous, now))
+	lines = strings.Split(out.String(), "\n")
+	require.Equal(t, "CHANGE", strings.Fields(lines[2])[11])
+	require.Equal(t, "+0", strings.Fields(lines[3])[7])
+	require.Equal(t, "-20", strings.Fields(lines[4])[7])
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// TaskBudgetExceededErrorType is the type of the ApplicationError a
+	// workflow fails with once it exceeded its TaskBudget with FailOverBudget.
+	TaskBudgetExceededErrorType = "TaskBudgetExceeded"
+
+	// workflowCodeTimeMetric is the timer recording, per execution, how long
+	// workflow code ran for.
+	workflowCodeTimeMetric = "timeout_interceptor_workflow_code_time"
+	// taskBudgetExceededMetric counts the executions that exceeded their budget.
+	taskBudgetExceededMetric = "timeout_interceptor_task_budget_exceeded"
+
+	taskBudgetMarkerID = "timeout_interceptor/task-budget-exceeded"
+)
+
+// taskBudget measures the wall-clock time workflow code runs for, which
+// timers cannot see: code such as a time.Sleep burns worker time without
+// moving workflow time.
+//
+// The workflow runs in a coroutine of its own, while the interceptor waits for
+// it in the root coroutine, with a condition that calls tick. In each round of
+// a workflow task, the workflow dispatcher polls the root coroutine before any
+// other, and once more when all of them are blocked: the time between two
+// polls of the same workflow task, which workflow.Now tells apart, is time
+// the workflow ran for, whatever it blocked on.
+//
+// Time spent replaying history is not counted: after the workflow was evicted
+// from the worker cache, the count restarts from zero. The decision to fail a
+// workflow over budget is recorded in history, so replaying it does not
+// depend on the measured time.
+type taskBudget struct {
+	limit time.Duration
+	fail  bool
+	// now is the wall clock workflow code is timed with.
+	now      func() time.Time
+	used     time.Duration
+	exceeded bool
+	// polled is when the root coroutine was last polled, during the workflow
+	// task started at polledTask.
+	polled     time.Time
+	polledTask time.Time
+}
+
+func (b *taskBudget) failing() bool {
+	return b.limit > 0 && b.fail
+}
+
+// tick charges the time since the last poll of the same workflow task, and
+// checks the budget.
+func (b *taskBudget) tick(ctx workflow.Context) {
+	if b.limit <= 0 {
+		return
+	}
+	now, task := b.now(), workflow.Now(ctx)
+	if !workflow.IsReplaying(ctx) && !b.polled.IsZero() && task.Equal(b.polledTask) {
+		b.used += now.Sub(b.polled)
+	}
+	b.polled, b.polledTask = now, task
+
+	exceeded := b.exceeded || b.used > b.limit
+	if b.fail {
+		err := workflow.MutableSideEffect(ctx, taskBudgetMarkerID,
+			func(ctx workflow.Context) interface{} { return exceeded },
+			func(a, b interface{}) bool { return a.(bool) == b.(bool) },
+		).Get(&exceeded)
+		if err != nil {
+			workflow.GetLogger(ctx).Error("Unable to check the task budget", "Error", err)
+		}
+	}
+	if exceeded && !b.exceeded {
+		workflow.GetLogger(ctx).Warn("Workflow exceeded its task budget",
+			"TaskBudget", b.limit, "Used", b.used, "Fail", b.fail)
+		workflow.GetMetricsHandler(ctx).Counter(taskBudgetExceededMetric).Inc(1)
+	}
+	b.exceeded = exceeded
+}
+
+// polling returns condition, ticking the budget each time it is polled.
+func (b *taskBudget) polling(ctx workflow.Context, condition func() bool) func() bool {
+	return func() bool {
+		b.tick(ctx)
+		return condition()
+	}
+}
+
+func (b *taskBudget) recordTotal(ctx workflow.Context) {
+	if b.limit <= 0 {
+		return
+	}
+	workflow.GetMetricsHandler(ctx).Timer(workflowCodeTimeMetric).Record(b.used)
+}
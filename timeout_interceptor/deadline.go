@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+// DeadlineHeaderKey is the header key carrying the deadline of the calling
+// workflow to its activities and child workflows.
+const DeadlineHeaderKey = "workflow-deadline"
+
+func headerDeadline(header map[string]*commonpb.Payload) (time.Time, error) {
+	var deadline time.Time
+	payload := header[DeadlineHeaderKey]
+	if payload == nil {
+		return deadline, nil
+	}
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &deadline); err != nil {
+		return deadline, fmt.Errorf("decoding %s: %w", DeadlineHeaderKey, err)
+	}
+	return deadline, nil
+}
+
+func setHeaderDeadline(header map[string]*commonpb.Payload, deadline time.Time) error {
+	payload, err := converter.GetDefaultDataConverter().ToPayload(deadline)
+	if err != nil {
+		return err
+	}
+	header[DeadlineHeaderKey] = payload
+	return nil
+}
+
+// deadlines returns the deadline nested work is canceled at and the hard
+// deadline it must be finished by. Until the workflow deadline passed, nested
+// work is canceled with the workflow; after it, clean up work gets what is
+// left of the grace period.
+func (t *workflowInboundInterceptor) deadlines(ctx workflow.Context) (soft, hard time.Time, ok bool) {
+	if t.deadline.IsZero() {
+		return soft, hard, false
+	}
+	hard = t.deadline.Add(t.gracePeriod)
+	if workflow.Now(ctx).Before(t.deadline) {
+		return t.deadline, hard, true
+	}
+	return hard, hard, true
+}
+
+// capTimeout returns timeout, unless it is unset or longer than remaining.
+func capTimeout(timeout, remaining time.Duration) time.Duration {
+	if timeout <= 0 || timeout > remaining {
+		return remaining
+	}
+	return timeout
+}
+
+// workflowOutboundInterceptor caps the timeouts of the activities and child
+// workflows of a workflow with a deadline at what is left of it, failing them
+// with a TimeoutErrorType error once nothing is left, and passes the
+// deadline on in the DeadlineHeaderKey header: activity contexts get it as
+// their deadline, and child workflows are canceled at it. Nested work thus
+// never outlives the workflow budget.
+type workflowOutboundInterceptor struct {
+	interceptor.WorkflowOutboundInterceptorBase
+	inbound *workflowInboundInterceptor
+}
+
+func (o *workflowOutboundInterceptor) ExecuteActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	soft, hard, ok := o.inbound.deadlines(ctx)
+	if !ok {
+		return o.Next.ExecuteActivity(ctx, activityType, args...)
+	}
+	if err := setHeaderDeadline(interceptor.WorkflowHeader(ctx), soft); err != nil {
+		return failedFuture(ctx, err)
+	}
+	remaining := hard.Sub(workflow.Now(ctx))
+	if remaining <= 0 {
+		return failedFuture(ctx, deadlineExceededError("activity", activityType, hard))
+	}
+	options := workflow.GetActivityOptions(ctx)
+	options.StartToCloseTimeout = capTimeout(options.StartToCloseTimeout, remaining)
+	options.ScheduleToCloseTimeout = capTimeout(options.ScheduleToCloseTimeout, remaining)
+	ctx = workflow.WithActivityOptions(ctx, options)
+	return o.Next.ExecuteActivity(ctx, activityType, args...)
+}
+
+func (o *workflowOutboundInterceptor) ExecuteLocalActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	soft, hard, ok := o.inbound.deadlines(ctx)
+	if !ok {
+		return o.Next.ExecuteLocalActivity(ctx, activityType, args...)
+	}
+	if err := setHeaderDeadline(interceptor.WorkflowHeader(ctx), soft); err != nil {
+		return failedFuture(ctx, err)
+	}
+	remaining := hard.Sub(workflow.Now(ctx))
+	if remaining <= 0 {
+		return failedFuture(ctx, deadlineExceededError("local activity", activityType, hard))
+	}
+	options := workflow.GetLocalActivityOptions(ctx)
+	options.StartToCloseTimeout = capTimeout(options.StartToCloseTimeout, remaining)
+	options.ScheduleToCloseTimeout = capTimeout(options.ScheduleToCloseTimeout, remaining)
+	ctx = workflow.WithLocalActivityOptions(ctx, options)
+	return o.Next.ExecuteLocalActivity(ctx, activityType, args...)
+}
+
+func (o *workflowOutboundInterceptor) ExecuteChildWorkflow(
+	ctx workflow.Context,
+	childWorkflowType string,
+	args ...interface{},
+) workflow.ChildWorkflowFuture {
+	soft, hard, ok := o.inbound.deadlines(ctx)
+	if !ok {
+		return o.Next.ExecuteChildWorkflow(ctx, childWorkflowType, args...)
+	}
+	// Encoding a time never fails; were it to, the child would only miss
+	// the deadline header and still be bounded by its capped timeouts.
+	if err := setHeaderDeadline(interceptor.WorkflowHeader(ctx), soft); err != nil {
+		workflow.GetLogger(ctx).Error("Unable to propagate the workflow deadline", "Error", err)
+	}
+	remaining := hard.Sub(workflow.Now(ctx))
+	if remaining <= 0 {
+		return failedChildWorkflowFuture{failedFuture(ctx,
+			deadlineExceededError("child workflow", childWorkflowType, hard))}
+	}
+	options := workflow.GetChildWorkflowOptions(ctx)
+	options.WorkflowExecutionTimeout = capTimeout(options.WorkflowExecutionTimeout, remaining)
+	options.WorkflowRunTimeout = capTimeout(options.WorkflowRunTimeout, remaining)
+	ctx = workflow.WithChildOptions(ctx, options)
+	return o.Next.ExecuteChildWorkflow(ctx, childWorkflowType, args...)
+}
+
+// deadlineExceededError fails nested work started once the hard deadline of
+// the workflow passed, which no timeout could bound anymore.
+func deadlineExceededError(kind, name string, hard time.Time) error {
+	return newTimeoutError(kind, name, "at the workflow deadline "+hard.Format(time.RFC3339Nano), nil)
+}
+
+func failedFuture(ctx workflow.Context, err error) workflow.Future {
+	future, settable := workflow.NewFuture(ctx)
+	settable.SetError(err)
+	return future
+}
+
+// failedChildWorkflowFuture is a child workflow that failed before it started.
+type failedChildWorkflowFuture struct {
+	workflow.Future
+}
+
+func (f failedChildWorkflowFuture) GetChildWorkflowExecution() workflow.Future {
+	return f.Future
+}
+
+func (f failedChildWorkflowFuture) SignalChildWorkflow(ctx workflow.Context, signalName string, data interface{}) workflow.Future {
+	return f.Future
+}
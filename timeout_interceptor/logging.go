@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// loggingInterceptor logs every inbound call of workflows and activities, and
+// every outbound call of workflows that records something in history:
+// activities, child workflows, timers, signals and cancellations of other
+// workflows, side effects and versions, upserts, Nexus operations and
+// continue-as-new. Calls that only read the workflow state, such as GetInfo
+// or Now, and waits without a timeout are not logged. It logs with the
+// workflow and activity loggers, which tag each entry with the workflow and
+// activity IDs and skip entries while replaying.
+type loggingInterceptor struct {
+	interceptor.WorkerInterceptorBase
+}
+
+// NewLoggingInterceptor logs the calls of workflows and activities.
+func NewLoggingInterceptor() interceptor.WorkerInterceptor {
+	return &loggingInterceptor{}
+}
+
+func (l *loggingInterceptor) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	i := &loggingActivityInbound{}
+	i.Next = next
+	return i
+}
+
+func (l *loggingInterceptor) InterceptWorkflow(
+	ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor,
+) interceptor.WorkflowInboundInterceptor {
+	i := &loggingWorkflowInbound{}
+	i.Next = next
+	return i
+}
+
+type loggingActivityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+}
+
+func (a *loggingActivityInbound) ExecuteActivity(
+	ctx context.Context,
+	in *interceptor.ExecuteActivityInput,
+) (interface{}, error) {
+	logger := activity.GetLogger(ctx)
+	logger.Info("ExecuteActivity started")
+	start := time.Now()
+	ret, err := a.Next.ExecuteActivity(ctx, in)
+	if err != nil {
+		logger.Warn("ExecuteActivity failed", "Duration", time.Since(start), "Error", err)
+	} else {
+		logger.Info("ExecuteActivity completed", "Duration", time.Since(start))
+	}
+	return ret, err
+}
+
+type loggingWorkflowInbound struct {
+	interceptor.WorkflowInboundInterceptorBase
+}
+
+func (w *loggingWorkflowInbound) Init(outbound interceptor.WorkflowOutboundInterceptor) error {
+	i := &loggingWorkflowOutbound{}
+	i.Next = outbound
+	return w.Next.Init(i)
+}
+
+func (w *loggingWorkflowInbound) ExecuteWorkflow(
+	ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput,
+) (interface{}, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("ExecuteWorkflow started")
+	start := workflow.Now(ctx)
+	ret, err := w.Next.ExecuteWorkflow(ctx, in)
+	if err != nil {
+		logger.Warn("ExecuteWorkflow failed", "Duration", workflow.Now(ctx).Sub(start), "Error", err)
+	} else {
+		logger.Info("ExecuteWorkflow completed", "Duration", workflow.Now(ctx).Sub(start))
+	}
+	return ret, err
+}
+
+func (w *loggingWorkflowInbound) HandleSignal(ctx workflow.Context, in *interceptor.HandleSignalInput) error {
+	workflow.GetLogger(ctx).Info("HandleSignal", "SignalName", in.SignalName)
+	return w.Next.HandleSignal(ctx, in)
+}
+
+func (w *loggingWorkflowInbound) HandleQuery(ctx workflow.Context, in *interceptor.HandleQueryInput) (interface{}, error) {
+	workflow.GetLogger(ctx).Info("HandleQuery", "QueryType", in.QueryType)
+	return w.Next.HandleQuery(ctx, in)
+}
+
+func (w *loggingWorkflowInbound) ValidateUpdate(ctx workflow.Context, in *interceptor.UpdateInput) error {
+	err := w.Next.ValidateUpdate(ctx, in)
+	if err != nil {
+		workflow.GetLogger(ctx).Info("ValidateUpdate rejected", "UpdateName", in.Name, "Error", err)
+	}
+	return err
+}
+
+func (w *loggingWorkflowInbound) ExecuteUpdate(ctx workflow.Context, in *interceptor.UpdateInput) (interface{}, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("ExecuteUpdate started", "UpdateName", in.Name)
+	ret, err := w.Next.ExecuteUpdate(ctx, in)
+	if err != nil {
+		logger.Warn("ExecuteUpdate failed", "UpdateName", in.Name, "Error", err)
+	} else {
+		logger.Info("ExecuteUpdate completed", "UpdateName", in.Name)
+	}
+	return ret, err
+}
+
+type loggingWorkflowOutbound struct {
+	interceptor.WorkflowOutboundInterceptorBase
+}
+
+func (w *loggingWorkflowOutbound) ExecuteActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	workflow.GetLogger(ctx).Info("ExecuteActivity scheduled", "ActivityType", activityType)
+	return w.Next.ExecuteActivity(ctx, activityType, args...)
+}
+
+func (w *loggingWorkflowOutbound) ExecuteLocalActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	workflow.GetLogger(ctx).Info("ExecuteLocalActivity scheduled", "ActivityType", activityType)
+	return w.Next.ExecuteLocalActivity(ctx, activityType, args...)
+}
+
+func (w *loggingWorkflowOutbound) ExecuteChildWorkflow(
+	ctx workflow.Context,
+	childWorkflowType string,
+	args ...interface{},
+) workflow.ChildWorkflowFuture {
+	workflow.GetLogger(ctx).Info("ExecuteChildWorkflow started", "ChildWorkflowType", childWorkflowType)
+	return w.Next.ExecuteChildWorkflow(ctx, childWorkflowType, args...)
+}
+
+func (w *loggingWorkflowOutbound) SignalExternalWorkflow(
+	ctx workflow.Context,
+	workflowID, runID, signalName string,
+	arg interface{},
+) workflow.Future {
+	workflow.GetLogger(ctx).Info("SignalExternalWorkflow",
+		"TargetWorkflowID", workflowID, "TargetRunID", runID, "SignalName", signalName)
+	return w.Next.SignalExternalWorkflow(ctx, workflowID, runID, signalName, arg)
+}
+
+func (w *loggingWorkflowOutbound) NewContinueAsNewError(
+	ctx workflow.Context,
+	wfn interface{},
+	args ...interface{},
+) error {
+	workflow.GetLogger(ctx).Info("ContinueAsNew requested")
+	return w.Next.NewContinueAsNewError(ctx, wfn, args...)
+}
+
+func (w *loggingWorkflowOutbound) SignalChildWorkflow(
+	ctx workflow.Context,
+	workflowID, signalName string,
+	arg interface{},
+) workflow.Future {
+	workflow.GetLogger(ctx).Info("SignalChildWorkflow", "ChildWorkflowID", workflowID, "SignalName", signalName)
+	return w.Next.SignalChildWorkflow(ctx, workflowID, signalName, arg)
+}
+
+func (w *loggingWorkflowOutbound) RequestCancelExternalWorkflow(ctx workflow.Context, workflowID, runID string) workflow.Future {
+	workflow.GetLogger(ctx).Info("RequestCancelExternalWorkflow", "TargetWorkflowID", workflowID, "TargetRunID", runID)
+	return w.Next.RequestCancelExternalWorkflow(ctx, workflowID, runID)
+}
+
+func (w *loggingWorkflowOutbound) NewTimer(ctx workflow.Context, d time.Duration) workflow.Future {
+	workflow.GetLogger(ctx).Info("NewTimer", "Duration", d)
+	return w.Next.NewTimer(ctx, d)
+}
+
+func (w *loggingWorkflowOutbound) NewTimerWithOptions(
+	ctx workflow.Context,
+	d time.Duration,
+	options workflow.TimerOptions,
+) workflow.Future {
+	workflow.GetLogger(ctx).Info("NewTimer", "Duration", d, "Summary", options.Summary)
+	return w.Next.NewTimerWithOptions(ctx, d, options)
+}
+
+func (w *loggingWorkflowOutbound) Sleep(ctx workflow.Context, d time.Duration) error {
+	workflow.GetLogger(ctx).Info("Sleep", "Duration", d)
+	return w.Next.Sleep(ctx, d)
+}
+
+func (w *loggingWorkflowOutbound) AwaitWithTimeout(
+	ctx workflow.Context,
+	timeout time.Duration,
+	condition func() bool,
+) (bool, error) {
+	workflow.GetLogger(ctx).Info("AwaitWithTimeout", "Timeout", timeout)
+	return w.Next.AwaitWithTimeout(ctx, timeout, condition)
+}
+
+func (w *loggingWorkflowOutbound) AwaitWithOptions(
+	ctx workflow.Context,
+	options workflow.AwaitOptions,
+	condition func() bool,
+) (bool, error) {
+	workflow.GetLogger(ctx).Info("AwaitWithOptions", "Timeout", options.Timeout)
+	return w.Next.AwaitWithOptions(ctx, options, condition)
+}
+
+func (w *loggingWorkflowOutbound) SideEffect(
+	ctx workflow.Context,
+	f func(ctx workflow.Context) interface{},
+) converter.EncodedValue {
+	workflow.GetLogger(ctx).Info("SideEffect")
+	return w.Next.SideEffect(ctx, f)
+}
+
+// MutableSideEffect is logged at debug level: it may be called on every
+// workflow task, while it only records a marker when its value changes.
+func (w *loggingWorkflowOutbound) MutableSideEffect(
+	ctx workflow.Context,
+	id string,
+	f func(ctx workflow.Context) interface{},
+	equals func(a, b interface{}) bool,
+) converter.EncodedValue {
+	workflow.GetLogger(ctx).Debug("MutableSideEffect", "ID", id)
+	return w.Next.MutableSideEffect(ctx, id, f, equals)
+}
+
+func (w *loggingWorkflowOutbound) GetVersion(
+	ctx workflow.Context,
+	changeID string,
+	minSupported, maxSupported workflow.Version,
+) workflow.Version {
+	version := w.Next.GetVersion(ctx, changeID, minSupported, maxSupported)
+	workflow.GetLogger(ctx).Info("GetVersion", "ChangeID", changeID, "Version", version)
+	return version
+}
+
+func (w *loggingWorkflowOutbound) UpsertSearchAttributes(ctx workflow.Context, attributes map[string]interface{}) error {
+	workflow.GetLogger(ctx).Info("UpsertSearchAttributes", "Count", len(attributes))
+	return w.Next.UpsertSearchAttributes(ctx, attributes)
+}
+
+func (w *loggingWorkflowOutbound) UpsertTypedSearchAttributes(
+	ctx workflow.Context,
+	attributes ...temporal.SearchAttributeUpdate,
+) error {
+	workflow.GetLogger(ctx).Info("UpsertSearchAttributes", "Count", len(attributes))
+	return w.Next.UpsertTypedSearchAttributes(ctx, attributes...)
+}
+
+func (w *loggingWorkflowOutbound) UpsertMemo(ctx workflow.Context, memo map[string]interface{}) error {
+	workflow.GetLogger(ctx).Info("UpsertMemo", "Count", len(memo))
+	return w.Next.UpsertMemo(ctx, memo)
+}
+
+func (w *loggingWorkflowOutbound) ExecuteNexusOperation(
+	ctx workflow.Context,
+	in interceptor.ExecuteNexusOperationInput,
+) workflow.NexusOperationFuture {
+	workflow.GetLogger(ctx).Info("ExecuteNexusOperation started", "Endpoint", in.Client.Endpoint(),
+		"Service", in.Client.Service(), "Operation", nexusOperationName(in.Operation))
+	return w.Next.ExecuteNexusOperation(ctx, in)
+}
+
+func (w *loggingWorkflowOutbound) RequestCancelNexusOperation(
+	ctx workflow.Context,
+	in interceptor.RequestCancelNexusOperationInput,
+) {
+	workflow.GetLogger(ctx).Info("RequestCancelNexusOperation", "Endpoint", in.Client.Endpoint(),
+		"Service", in.Client.Service(), "Operation", nexusOperationName(in.Operation))
+	w.Next.RequestCancelNexusOperation(ctx, in)
+}
+
+// nexusOperationName returns the name of a Nexus operation, given by name or
+// by reference.
+func nexusOperationName(operation any) string {
+	switch op := operation.(type) {
+	case string:
+		return op
+	case interface{ Name() string }:
+		return op.Name()
+	}
+	return fmt.Sprintf("%v", operation)
+}
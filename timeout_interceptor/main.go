@@ -3,18 +3,22 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"go.temporal.io/sdk/client"
-	"go.temporal.io/sdk/interceptor"
 	sdkinterceptor "go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
 )
 
+var policiesPath = flag.String("policies", "", "JSON file with the timeout policies per workflow and activity type")
+
 func main() {
+	flag.Parse()
 	if err := run(); err != nil {
 		log.Fatal(err)
 	}
@@ -24,17 +28,33 @@ func run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	c, err := client.Dial(client.Options{})
+	// The payload size interceptor checks the client calls, and the workers of
+	// the client run it before their own interceptors.
+	c, err := client.Dial(client.Options{
+		Interceptors: []sdkinterceptor.ClientInterceptor{NewPayloadSizeInterceptor(DefaultPayloadSizeLimit)},
+	})
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
+	timeouts := NewTimeoutInterceptor(5 * time.Second)
+	if *policiesPath != "" {
+		policies, err := LoadTimeoutPolicies(*policiesPath)
+		if err != nil {
+			return err
+		}
+		timeouts = NewPolicyTimeoutInterceptor(policies)
+	}
+
 	// Start worker
 	var taskQueue = "my-task-queue" + uuid.New().String()
 	w := worker.New(c, taskQueue, worker.Options{
+		// Interceptors run in order, so logging sees the errors of the others.
 		Interceptors: []sdkinterceptor.WorkerInterceptor{
-			NewTimeoutInterceptor(5 * time.Second),
+			NewLoggingInterceptor(),
+			NewActivityPanicInterceptor(),
+			timeouts,
 		},
 	})
 	w.RegisterWorkflow(MyWorkflow)
@@ -52,7 +72,12 @@ func run() error {
 	)
 	if err != nil {
 		return err
-	} else if err := run.Get(context.Background(), nil); err != nil {
+	}
+	var appErr *temporal.ApplicationError
+	if err := run.Get(context.Background(), nil); errors.As(err, &appErr) && appErr.Type() == TimeoutErrorType {
+		log.Printf("Workflow timed out: %v", err)
+		return nil
+	} else if err != nil {
 		return err
 	}
 	log.Printf("Workflow done")
@@ -73,51 +98,3 @@ func MyWorkflow(ctx workflow.Context) error {
 	}
 	return nil
 }
-
-type timeoutInterceptor struct {
-	interceptor.WorkerInterceptorBase
-	duration time.Duration
-}
-
-func NewTimeoutInterceptor(duration time.Duration) interceptor.WorkerInterceptor {
-	return &timeoutInterceptor{duration: duration}
-}
-
-func (w *timeoutInterceptor) InterceptActivity(
-	ctx context.Context,
-	next interceptor.ActivityInboundInterceptor,
-) interceptor.ActivityInboundInterceptor {
-	return next
-}
-
-func (w *timeoutInterceptor) InterceptWorkflow(
-	ctx workflow.Context,
-	next interceptor.WorkflowInboundInterceptor,
-) interceptor.WorkflowInboundInterceptor {
-	i := &workflowInboundInterceptor{root: w}
-	i.Next = next
-	return i
-}
-
-type workflowInboundInterceptor struct {
-	interceptor.WorkflowInboundInterceptorBase
-	root *timeoutInterceptor
-}
-
-func (t *workflowInboundInterceptor) ExecuteWorkflow(
-	ctx workflow.Context,
-	in *sdkinterceptor.ExecuteWorkflowInput,
-) (interface{}, error) {
-	ctxTmt := setTimeout(ctx, t.root.duration)
-	ret, err := t.Next.ExecuteWorkflow(ctxTmt, in)
-	return ret, err
-}
-
-func setTimeout(ctx workflow.Context, duration time.Duration) workflow.Context {
-	timerCtx, timerCancel := workflow.WithCancel(ctx)
-	workflow.Go(ctx, func(ctx workflow.Context) {
-		workflow.Sleep(ctx, duration)
-		timerCancel()
-	})
-	return timerCtx
-}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally/v4"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/activity"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+// sleepyWorkflow sleeps for d, then cleans up for cleanup if it was canceled.
+func sleepyWorkflow(ctx workflow.Context, d, cleanup time.Duration) (string, error) {
+	if err := workflow.Sleep(ctx, d); err != nil {
+		ctx, _ := workflow.NewDisconnectedContext(ctx)
+		_ = workflow.Sleep(ctx, cleanup)
+		return "cleaned up", err
+	}
+	return "done", nil
+}
+
+func fastWorkflow(ctx workflow.Context, d, cleanup time.Duration) (string, error) {
+	return sleepyWorkflow(ctx, d, cleanup)
+}
+
+// sleepyActivity sleeps for d, or until ctx is done and then for cleanup.
+func sleepyActivity(ctx context.Context, d, cleanup time.Duration) (string, error) {
+	select {
+	case <-time.After(d):
+		return "done", nil
+	case <-ctx.Done():
+		time.Sleep(cleanup)
+		return "cleaned up", ctx.Err()
+	}
+}
+
+func activityWorkflow(ctx workflow.Context, d, cleanup time.Duration) (string, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 1},
+	})
+	var result string
+	err := workflow.ExecuteActivity(ctx, sleepyActivity, d, cleanup).Get(ctx, &result)
+	return result, err
+}
+
+var testPolicies = TimeoutPolicies{
+	DefaultWorkflow: TimeoutPolicy{Timeout: time.Hour},
+	Workflows: map[string]TimeoutPolicy{
+		"sleepyWorkflow": {Timeout: 10 * time.Second, GracePeriod: 5 * time.Second},
+	},
+	Activities: map[string]TimeoutPolicy{
+		"sleepyActivity": {Timeout: 100 * time.Millisecond, GracePeriod: 100 * time.Millisecond},
+	},
+}
+
+func newTestEnv(policies TimeoutPolicies) *testsuite.TestWorkflowEnvironment {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{NewPolicyTimeoutInterceptor(policies)},
+	})
+	env.RegisterWorkflow(sleepyWorkflow)
+	env.RegisterWorkflow(fastWorkflow)
+	env.RegisterWorkflow(activityWorkflow)
+	env.RegisterActivity(sleepyActivity)
+	return env
+}
+
+func requireTimeoutError(t *testing.T, err error) *temporal.ApplicationError {
+	var appErr *temporal.ApplicationError
+	require.True(t, errors.As(err, &appErr), "expected an application error, got %v", err)
+	require.Equal(t, TimeoutErrorType, appErr.Type())
+	return appErr
+}
+
+func policyPayload(t *testing.T, policy TimeoutPolicy) *commonpb.Payload {
+	payload, err := converter.GetDefaultDataConverter().ToPayload(policy)
+	require.NoError(t, err)
+	return payload
+}
+
+func Test_WorkflowTypePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow interface{}
+		timeout  bool
+	}{
+		{name: "table entry", workflow: sleepyWorkflow, timeout: true},
+		{name: "default", workflow: fastWorkflow, timeout: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(testPolicies)
+			env.ExecuteWorkflow(tt.workflow, time.Minute, time.Second)
+
+			require.True(t, env.IsWorkflowCompleted())
+			if !tt.timeout {
+				require.NoError(t, env.GetWorkflowError())
+				return
+			}
+			requireTimeoutError(t, env.GetWorkflowError())
+		})
+	}
+}
+
+func Test_GracePeriod(t *testing.T) {
+	t.Run("clean up within grace period", func(t *testing.T) {
+		env := newTestEnv(testPolicies)
+		env.ExecuteWorkflow(sleepyWorkflow, time.Minute, time.Second)
+
+		appErr := requireTimeoutError(t, env.GetWorkflowError())
+		// The workflow's own cancellation error is kept as the cause.
+		var canceled *temporal.CanceledError
+		require.True(t, errors.As(appErr, &canceled))
+	})
+	t.Run("clean up exceeding grace period", func(t *testing.T) {
+		env := newTestEnv(testPolicies)
+		env.ExecuteWorkflow(sleepyWorkflow, time.Minute, time.Minute)
+
+		appErr := requireTimeoutError(t, env.GetWorkflowError())
+		require.Nil(t, errors.Unwrap(appErr))
+	})
+}
+
+func Test_MemoPolicy(t *testing.T) {
+	env := newTestEnv(testPolicies)
+	require.NoError(t, env.SetMemoOnStart(map[string]interface{}{TimeoutPolicyKey: TimeoutPolicy{Timeout: 30 * time.Second}}))
+	// Without the memo, the default hour would let the workflow complete.
+	env.ExecuteWorkflow(fastWorkflow, time.Minute, time.Second)
+
+	requireTimeoutError(t, env.GetWorkflowError())
+}
+
+func Test_HeaderPolicy(t *testing.T) {
+	env := newTestEnv(testPolicies)
+	env.SetHeader(&commonpb.Header{Fields: map[string]*commonpb.Payload{
+		TimeoutPolicyKey: policyPayload(t, TimeoutPolicy{}),
+	}})
+	// The header disables the table entry of sleepyWorkflow.
+	env.ExecuteWorkflow(sleepyWorkflow, time.Minute, time.Second)
+
+	require.NoError(t, env.GetWorkflowError())
+	var result string
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, "done", result)
+}
+
+func Test_InvalidPolicy(t *testing.T) {
+	invalid, err := converter.GetDefaultDataConverter().ToPayload("every minute")
+	require.NoError(t, err)
+	for _, key := range []string{TimeoutPolicyKey, DeadlineHeaderKey} {
+		t.Run(key, func(t *testing.T) {
+			env := newTestEnv(testPolicies)
+			env.SetHeader(&commonpb.Header{Fields: map[string]*commonpb.Payload{key: invalid}})
+			env.ExecuteWorkflow(sleepyWorkflow, time.Minute, time.Second)
+
+			var appErr *temporal.ApplicationError
+			require.True(t, errors.As(env.GetWorkflowError(), &appErr))
+			require.Equal(t, InvalidTimeoutPolicyErrorType, appErr.Type())
+		})
+	}
+}
+
+func Test_ActivityTypePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cleanup time.Duration
+	}{
+		{name: "clean up within grace period", cleanup: 0},
+		{name: "clean up exceeding grace period", cleanup: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(testPolicies)
+			env.ExecuteWorkflow(activityWorkflow, time.Minute, tt.cleanup)
+
+			var activityErr *temporal.ActivityError
+			require.True(t, errors.As(env.GetWorkflowError(), &activityErr))
+			requireTimeoutError(t, activityErr)
+		})
+	}
+
+	t.Run("within timeout", func(t *testing.T) {
+		env := newTestEnv(testPolicies)
+		env.ExecuteWorkflow(activityWorkflow, time.Millisecond, time.Duration(0))
+
+		require.NoError(t, env.GetWorkflowError())
+	})
+}
+
+func Test_ActivityDefaultPolicy(t *testing.T) {
+	env := newTestEnv(TimeoutPolicies{
+		DefaultActivity: TimeoutPolicy{Timeout: 50 * time.Millisecond},
+	})
+	env.ExecuteWorkflow(activityWorkflow, time.Minute, time.Duration(0))
+
+	requireTimeoutError(t, env.GetWorkflowError())
+}
+
+func Test_ActivityReportsDeadlineThatFired(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration
+		when     string
+	}{
+		{name: "policy timeout", deadline: time.Minute, when: "after 100ms"},
+		{name: "workflow deadline", deadline: 50 * time.Millisecond, when: "at the workflow deadline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestActivityEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{NewPolicyTimeoutInterceptor(testPolicies)},
+			})
+			env.RegisterActivity(sleepyActivity)
+			header := map[string]*commonpb.Payload{}
+			require.NoError(t, setHeaderDeadline(header, time.Now().Add(tt.deadline)))
+			env.SetHeader(&commonpb.Header{Fields: header})
+
+			_, err := env.ExecuteActivity(sleepyActivity, time.Minute, time.Duration(0))
+
+			appErr := requireTimeoutError(t, err)
+			require.Contains(t, appErr.Message(), tt.when)
+		})
+	}
+}
+
+func Test_LoadTimeoutPolicies(t *testing.T) {
+	policies, err := LoadTimeoutPolicies("policies.json")
+	require.NoError(t, err)
+	require.Equal(t, TimeoutPolicy{Timeout: 5 * time.Second}, policies.workflow("Unknown"))
+	require.Equal(t, TimeoutPolicy{Timeout: 3 * time.Second, GracePeriod: time.Second, TaskBudget: time.Second},
+		policies.workflow("MyWorkflow"))
+	require.Equal(t, TimeoutPolicy{Timeout: 10 * time.Second, GracePeriod: 2 * time.Second}, policies.activity("Any"))
+}
+
+// deadlineActivity returns the deadline of its context.
+func deadlineActivity(ctx context.Context) (time.Time, error) {
+	deadline, _ := ctx.Deadline()
+	return deadline, nil
+}
+
+type deadlines struct {
+	Start, Activity time.Time
+}
+
+func parentWorkflow(ctx workflow.Context, childSleep time.Duration) (deadlines, error) {
+	result := deadlines{Start: workflow.Now(ctx)}
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Hour})
+	if err := workflow.ExecuteActivity(ctx, deadlineActivity).Get(ctx, &result.Activity); err != nil {
+		return result, err
+	}
+	ctx = workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{WorkflowExecutionTimeout: time.Hour})
+	err := workflow.ExecuteChildWorkflow(ctx, fastWorkflow, childSleep, time.Duration(0)).Get(ctx, nil)
+	return result, err
+}
+
+func newDeadlineTestEnv(t *testing.T) *testsuite.TestWorkflowEnvironment {
+	env := newTestEnv(TimeoutPolicies{
+		Workflows: map[string]TimeoutPolicy{
+			"parentWorkflow": {Timeout: 10 * time.Minute, GracePeriod: time.Minute},
+		},
+	})
+	env.RegisterWorkflow(parentWorkflow)
+	env.RegisterActivity(deadlineActivity)
+	return env
+}
+
+func Test_DeadlinePropagation(t *testing.T) {
+	env := newDeadlineTestEnv(t)
+	var activityTimeout, childTimeout time.Duration
+	env.SetOnActivityStartedListener(func(info *activity.Info, ctx context.Context, args converter.EncodedValues) {
+		activityTimeout = info.Deadline.Sub(info.StartedTime)
+	})
+	env.SetOnChildWorkflowStartedListener(func(info *workflow.Info, ctx workflow.Context, args converter.EncodedValues) {
+		childTimeout = info.WorkflowExecutionTimeout
+	})
+
+	env.ExecuteWorkflow(parentWorkflow, time.Second)
+
+	require.NoError(t, env.GetWorkflowError())
+	var result deadlines
+	require.NoError(t, env.GetWorkflowResult(&result))
+	// The activity context ends with the parent, and its timeout and the
+	// child's are capped at the end of the parent's grace period.
+	require.WithinDuration(t, result.Start.Add(10*time.Minute), result.Activity, time.Second)
+	require.NotZero(t, activityTimeout)
+	require.LessOrEqual(t, activityTimeout, 11*time.Minute)
+	require.NotZero(t, childTimeout)
+	require.LessOrEqual(t, childTimeout, 11*time.Minute)
+}
+
+func Test_ChildTimesOutWithParentDeadline(t *testing.T) {
+	env := newDeadlineTestEnv(t)
+
+	// fastWorkflow has no policy of its own, yet outliving the parent
+	// deadline times it out.
+	env.ExecuteWorkflow(parentWorkflow, time.Hour)
+
+	var childErr *temporal.ChildWorkflowExecutionError
+	require.True(t, errors.As(env.GetWorkflowError(), &childErr), "got %v", env.GetWorkflowError())
+	requireTimeoutError(t, childErr)
+}
+
+// lateCleanupWorkflow waits to be canceled, then cleans up with an activity,
+// a local activity or a child workflow once cleanup elapsed.
+func lateCleanupWorkflow(ctx workflow.Context, kind string, cleanup time.Duration) error {
+	_ = workflow.Await(ctx, func() bool { return false })
+	ctx, _ = workflow.NewDisconnectedContext(ctx)
+	_ = workflow.Sleep(ctx, cleanup)
+	switch kind {
+	case "activity":
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Hour})
+		return workflow.ExecuteActivity(ctx, deadlineActivity).Get(ctx, nil)
+	case "local activity":
+		ctx = workflow.WithLocalActivityOptions(ctx, workflow.LocalActivityOptions{StartToCloseTimeout: time.Hour})
+		return workflow.ExecuteLocalActivity(ctx, deadlineActivity).Get(ctx, nil)
+	default:
+		ctx = workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{WorkflowExecutionTimeout: time.Hour})
+		return workflow.ExecuteChildWorkflow(ctx, fastWorkflow, time.Second, time.Duration(0)).Get(ctx, nil)
+	}
+}
+
+func Test_NestedWorkFailsPastDeadline(t *testing.T) {
+	for _, kind := range []string{"activity", "local activity", "child workflow"} {
+		t.Run(kind, func(t *testing.T) {
+			env := newTestEnv(TimeoutPolicies{
+				Workflows: map[string]TimeoutPolicy{
+					"lateCleanupWorkflow": {Timeout: 10 * time.Second, GracePeriod: 5 * time.Second},
+				},
+			})
+			env.RegisterWorkflow(lateCleanupWorkflow)
+			env.RegisterActivity(deadlineActivity)
+			env.SetOnActivityStartedListener(func(*activity.Info, context.Context, converter.EncodedValues) {
+				t.Fatal("the activity started past the deadline")
+			})
+			env.SetOnChildWorkflowStartedListener(func(*workflow.Info, workflow.Context, converter.EncodedValues) {
+				t.Fatal("the child workflow started past the deadline")
+			})
+			// Canceled before its deadline, the workflow handles the
+			// cancellation itself, and cleans up once the grace period is over.
+			env.RegisterDelayedCallback(env.CancelWorkflow, 5*time.Second)
+			env.ExecuteWorkflow(lateCleanupWorkflow, kind, 20*time.Second)
+
+			require.True(t, env.IsWorkflowCompleted())
+			appErr := requireTimeoutError(t, env.GetWorkflowError())
+			require.Contains(t, appErr.Message(), kind+" ")
+		})
+	}
+}
+
+// testClock is a wall clock that only moves when advanced.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// busyWorkflow burns worker time without moving workflow time, like MyWorkflow,
+// advancing clock by burn in each iteration. Iterations are separated by a
+// sleep, or by an activity with blockOn "activity".
+func busyWorkflow(clock *testClock) func(ctx workflow.Context, blockOn string, iterations int, burn time.Duration) (int, error) {
+	return func(ctx workflow.Context, blockOn string, iterations int, burn time.Duration) (int, error) {
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Minute})
+		for i := 0; i < iterations; i++ {
+			clock.advance(burn)
+			var err error
+			if blockOn == "activity" {
+				err = workflow.ExecuteActivity(ctx, echoActivity, "burnt", 0).Get(ctx, nil)
+			} else {
+				err = workflow.Sleep(ctx, time.Second)
+			}
+			if err != nil {
+				return i, err
+			}
+		}
+		return iterations, nil
+	}
+}
+
+func newBudgetTestEnv(policy TimeoutPolicy) (*testsuite.TestWorkflowEnvironment, tally.TestScope) {
+	scope := tally.NewTestScope("", nil)
+	testSuite := &testsuite.WorkflowTestSuite{}
+	testSuite.SetMetricsHandler(sdktally.NewMetricsHandler(scope))
+	env := testSuite.NewTestWorkflowEnvironment()
+	clock := &testClock{now: time.Now()}
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{&timeoutInterceptor{
+			policies: TimeoutPolicies{Workflows: map[string]TimeoutPolicy{"busyWorkflow": policy}},
+			now:      clock.Now,
+		}},
+	})
+	env.RegisterWorkflowWithOptions(busyWorkflow(clock), workflow.RegisterOptions{Name: "busyWorkflow"})
+	env.RegisterActivity(echoActivity)
+	return env, scope
+}
+
+// budgetMetrics returns the number of executions over budget and the recorded
+// workflow code times.
+func budgetMetrics(scope tally.TestScope) (exceeded int64, codeTimes []time.Duration) {
+	snapshot := scope.Snapshot()
+	for _, counter := range snapshot.Counters() {
+		if counter.Name() == taskBudgetExceededMetric {
+			exceeded += counter.Value()
+		}
+	}
+	for _, timer := range snapshot.Timers() {
+		if timer.Name() == workflowCodeTimeMetric {
+			codeTimes = append(codeTimes, timer.Values()...)
+		}
+	}
+	return exceeded, codeTimes
+}
+
+func Test_TaskBudget(t *testing.T) {
+	for _, blockOn := range []string{"sleep", "activity"} {
+		t.Run(blockOn, func(t *testing.T) {
+			testTaskBudget(t, blockOn)
+		})
+	}
+}
+
+func testTaskBudget(t *testing.T, blockOn string) {
+	t.Run("within budget", func(t *testing.T) {
+		env, scope := newBudgetTestEnv(TimeoutPolicy{TaskBudget: time.Second, FailOverBudget: true})
+		env.ExecuteWorkflow("busyWorkflow", blockOn, 3, 20*time.Millisecond)
+
+		require.NoError(t, env.GetWorkflowError())
+		exceeded, codeTimes := budgetMetrics(scope)
+		require.Zero(t, exceeded)
+		require.Len(t, codeTimes, 1)
+		require.Equal(t, 60*time.Millisecond, codeTimes[0])
+	})
+	t.Run("warn", func(t *testing.T) {
+		env, scope := newBudgetTestEnv(TimeoutPolicy{TaskBudget: 50 * time.Millisecond})
+		env.ExecuteWorkflow("busyWorkflow", blockOn, 5, 30*time.Millisecond)
+
+		require.NoError(t, env.GetWorkflowError())
+		var iterations int
+		require.NoError(t, env.GetWorkflowResult(&iterations))
+		require.Equal(t, 5, iterations)
+		exceeded, codeTimes := budgetMetrics(scope)
+		require.Equal(t, int64(1), exceeded)
+		require.Equal(t, 150*time.Millisecond, codeTimes[0])
+	})
+	t.Run("fail", func(t *testing.T) {
+		env, scope := newBudgetTestEnv(TimeoutPolicy{TaskBudget: 50 * time.Millisecond, FailOverBudget: true})
+		env.ExecuteWorkflow("busyWorkflow", blockOn, 5, 30*time.Millisecond)
+
+		var appErr *temporal.ApplicationError
+		require.True(t, errors.As(env.GetWorkflowError(), &appErr), "got %v", env.GetWorkflowError())
+		require.Equal(t, TaskBudgetExceededErrorType, appErr.Type())
+		exceeded, codeTimes := budgetMetrics(scope)
+		require.Equal(t, int64(1), exceeded)
+		// The second iteration exceeds the budget, long before the fifth.
+		require.Equal(t, 60*time.Millisecond, codeTimes[0])
+	})
+}
+
+func panickyActivity(ctx context.Context, in string, resultSize int) (string, error) {
+	panic("boom")
+}
+
+// echoActivity returns in, or a result of resultSize bytes if set.
+func echoActivity(ctx context.Context, in string, resultSize int) (string, error) {
+	if resultSize > 0 {
+		return strings.Repeat("x", resultSize), nil
+	}
+	return in, nil
+}
+
+// toolkitWorkflow runs activityName with in and resultSize.
+func toolkitWorkflow(ctx workflow.Context, activityName, in string, resultSize int) (string, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 1},
+	})
+	var result string
+	err := workflow.ExecuteActivity(ctx, activityName, in, resultSize).Get(ctx, &result)
+	return result, err
+}
+
+// capturingLogger records the messages and keyvals it is given.
+type capturingLogger struct {
+	entries []logEntry
+}
+
+type logEntry struct {
+	msg     string
+	keyvals map[interface{}]interface{}
+}
+
+func (l *capturingLogger) log(msg string, keyvals ...interface{}) {
+	entry := logEntry{msg: msg, keyvals: map[interface{}]interface{}{}}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		entry.keyvals[keyvals[i]] = keyvals[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func (l *capturingLogger) Debug(msg string, keyvals ...interface{}) { l.log(msg, keyvals...) }
+func (l *capturingLogger) Info(msg string, keyvals ...interface{})  { l.log(msg, keyvals...) }
+func (l *capturingLogger) Warn(msg string, keyvals ...interface{})  { l.log(msg, keyvals...) }
+func (l *capturingLogger) Error(msg string, keyvals ...interface{}) { l.log(msg, keyvals...) }
+
+func (l *capturingLogger) find(msg string) (logEntry, bool) {
+	for _, entry := range l.entries {
+		if entry.msg == msg {
+			return entry, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func newToolkitTestEnv(logger *capturingLogger, payloadLimit int) *testsuite.TestWorkflowEnvironment {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	if logger != nil {
+		testSuite.SetLogger(logger)
+	}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{
+			NewLoggingInterceptor(),
+			NewActivityPanicInterceptor(),
+			NewPayloadSizeInterceptor(payloadLimit),
+		},
+	})
+	env.RegisterWorkflow(toolkitWorkflow)
+	env.RegisterActivity(panickyActivity)
+	env.RegisterActivity(echoActivity)
+	return env
+}
+
+func Test_LoggingInterceptor(t *testing.T) {
+	logger := &capturingLogger{}
+	env := newToolkitTestEnv(logger, DefaultPayloadSizeLimit)
+	env.ExecuteWorkflow(toolkitWorkflow, "echoActivity", "hello", 0)
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	for _, msg := range []string{
+		"ExecuteWorkflow started",
+		"ExecuteActivity scheduled",
+		"ExecuteWorkflow completed",
+	} {
+		_, ok := logger.find(msg)
+		require.True(t, ok, msg)
+	}
+	entry, _ := logger.find("ExecuteActivity scheduled")
+	require.Equal(t, "echoActivity", entry.keyvals["ActivityType"])
+
+	// Unlike workflow loggers of the test environment, activity loggers are
+	// tagged as on a worker.
+	for _, msg := range []string{"ExecuteActivity started", "ExecuteActivity completed"} {
+		entry, ok := logger.find(msg)
+		require.True(t, ok, msg)
+		require.Equal(t, "default-test-workflow-id", entry.keyvals["WorkflowID"], msg)
+		require.NotEmpty(t, entry.keyvals["ActivityID"], msg)
+	}
+}
+
+// historyWorkflow makes outbound calls that record something in history,
+// without activities.
+func historyWorkflow(ctx workflow.Context) error {
+	if err := workflow.Sleep(ctx, time.Second); err != nil {
+		return err
+	}
+	if err := workflow.NewTimer(ctx, time.Second).Get(ctx, nil); err != nil {
+		return err
+	}
+	var id string
+	if err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} { return "id" }).Get(&id); err != nil {
+		return err
+	}
+	workflow.GetVersion(ctx, "change", workflow.DefaultVersion, 1)
+	return workflow.UpsertMemo(ctx, map[string]interface{}{"id": id})
+}
+
+func Test_LoggingInterceptor_HistoryCalls(t *testing.T) {
+	logger := &capturingLogger{}
+	env := newToolkitTestEnv(logger, DefaultPayloadSizeLimit)
+	env.RegisterWorkflow(historyWorkflow)
+	env.ExecuteWorkflow(historyWorkflow)
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	for _, msg := range []string{"Sleep", "NewTimer", "SideEffect", "GetVersion", "UpsertMemo"} {
+		_, ok := logger.find(msg)
+		require.True(t, ok, msg)
+	}
+	entry, _ := logger.find("GetVersion")
+	require.Equal(t, "change", entry.keyvals["ChangeID"])
+	require.Equal(t, workflow.Version(1), entry.keyvals["Version"])
+}
+
+func Test_ActivityPanicInterceptor(t *testing.T) {
+	env := newToolkitTestEnv(nil, DefaultPayloadSizeLimit)
+	env.ExecuteWorkflow(toolkitWorkflow, "panickyActivity", "", 0)
+	require.True(t, env.IsWorkflowCompleted())
+
+	var appErr *temporal.ApplicationError
+	require.True(t, errors.As(env.GetWorkflowError(), &appErr))
+	require.Equal(t, ActivityPanicErrorType, appErr.Type())
+	require.Contains(t, appErr.Message(), "boom")
+	require.False(t, appErr.NonRetryable())
+	var stack string
+	require.NoError(t, appErr.Details(&stack))
+	require.Contains(t, stack, "panickyActivity")
+}
+
+func Test_PayloadSizeInterceptor(t *testing.T) {
+	requirePayloadTooLarge := func(t *testing.T, err error) {
+		var appErr *temporal.ApplicationError
+		require.True(t, errors.As(err, &appErr))
+		require.Equal(t, PayloadTooLargeErrorType, appErr.Type())
+		require.True(t, appErr.NonRetryable())
+	}
+
+	t.Run("input", func(t *testing.T) {
+		env := newToolkitTestEnv(nil, 1024)
+		env.SetOnActivityStartedListener(func(*activity.Info, context.Context, converter.EncodedValues) {
+			t.Fatal("oversized input was scheduled")
+		})
+		env.ExecuteWorkflow(toolkitWorkflow, "echoActivity", strings.Repeat("x", 2048), 0)
+		require.True(t, env.IsWorkflowCompleted())
+		requirePayloadTooLarge(t, env.GetWorkflowError())
+	})
+
+	t.Run("result", func(t *testing.T) {
+		env := newToolkitTestEnv(nil, 1024)
+		env.ExecuteWorkflow(toolkitWorkflow, "echoActivity", "hello", 2048)
+		require.True(t, env.IsWorkflowCompleted())
+		requirePayloadTooLarge(t, env.GetWorkflowError())
+	})
+
+	t.Run("client", func(t *testing.T) {
+		outbound := NewPayloadSizeInterceptor(1024).InterceptClient(nil)
+		oversized := strings.Repeat("x", 2048)
+
+		_, err := outbound.ExecuteWorkflow(context.Background(), &interceptor.ClientExecuteWorkflowInput{
+			WorkflowType: "toolkitWorkflow", Args: []interface{}{"echoActivity", oversized, 0},
+		})
+		requirePayloadTooLarge(t, err)
+		err = outbound.SignalWorkflow(context.Background(), &interceptor.ClientSignalWorkflowInput{
+			SignalName: "signal", Arg: oversized,
+		})
+		requirePayloadTooLarge(t, err)
+		_, err = outbound.UpdateWorkflow(context.Background(), &interceptor.ClientUpdateWorkflowInput{
+			UpdateName: "update", Args: []interface{}{oversized},
+		})
+		requirePayloadTooLarge(t, err)
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		env := newToolkitTestEnv(nil, 1024)
+		env.ExecuteWorkflow(toolkitWorkflow, "echoActivity", "hello", 512)
+		require.True(t, env.IsWorkflowCompleted())
+		require.NoError(t, env.GetWorkflowError())
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// PayloadTooLargeErrorType is the type of the ApplicationError returned
+	// for activity inputs and results exceeding the size limit.
+	PayloadTooLargeErrorType = "PayloadTooLarge"
+	// DefaultPayloadSizeLimit is the default blob size limit of the server.
+	DefaultPayloadSizeLimit = 2 * 1024 * 1024
+)
+
+// payloadSizeInterceptor rejects payloads larger than a limit before the
+// server does. On a client, it rejects the inputs of started, signaled and
+// updated workflows. On a worker, it fails activities with an oversized input
+// or result with a non-retryable error the workflow can handle, where the
+// server would fail the workflow task on an oversized input, and the activity
+// task on an oversized result. Workflows read the limit through a SideEffect
+// the first time they schedule an activity, so that changing the limit never
+// breaks the replay of open executions. Payloads are sized with the default
+// data converter.
+type payloadSizeInterceptor struct {
+	interceptor.InterceptorBase
+	limit int
+}
+
+// NewPayloadSizeInterceptor rejects payloads larger than limit bytes. Set on
+// client.Options, it applies to the workers of the client too.
+func NewPayloadSizeInterceptor(limit int) interceptor.Interceptor {
+	return &payloadSizeInterceptor{limit: limit}
+}
+
+func (p *payloadSizeInterceptor) InterceptClient(
+	next interceptor.ClientOutboundInterceptor,
+) interceptor.ClientOutboundInterceptor {
+	i := &payloadSizeClientOutbound{root: p}
+	i.Next = next
+	return i
+}
+
+func (p *payloadSizeInterceptor) InterceptWorkflow(
+	ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor,
+) interceptor.WorkflowInboundInterceptor {
+	i := &payloadSizeWorkflowInbound{root: p}
+	i.Next = next
+	return i
+}
+
+func (p *payloadSizeInterceptor) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	i := &payloadSizeActivityInbound{root: p}
+	i.Next = next
+	return i
+}
+
+// checkPayloadSize returns a PayloadTooLargeErrorType error if values encode
+// to more than limit bytes.
+func checkPayloadSize(limit int, what string, values ...interface{}) error {
+	payloads, err := converter.GetDefaultDataConverter().ToPayloads(values...)
+	if err != nil {
+		// Left to the SDK, which reports encoding errors itself.
+		return nil
+	}
+	if size := payloadsSize(payloads); size > limit {
+		return temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("%s of %d bytes exceeds the limit of %d bytes", what, size, limit),
+			PayloadTooLargeErrorType, nil)
+	}
+	return nil
+}
+
+// payloadsSize approximates the encoded size of payloads by their data and
+// metadata.
+func payloadsSize(payloads *commonpb.Payloads) int {
+	size := 0
+	for _, payload := range payloads.GetPayloads() {
+		size += len(payload.GetData())
+		for k, v := range payload.GetMetadata() {
+			size += len(k) + len(v)
+		}
+	}
+	return size
+}
+
+type payloadSizeActivityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *payloadSizeInterceptor
+}
+
+func (a *payloadSizeActivityInbound) ExecuteActivity(
+	ctx context.Context,
+	in *interceptor.ExecuteActivityInput,
+) (interface{}, error) {
+	ret, err := a.Next.ExecuteActivity(ctx, in)
+	if err != nil || ret == nil {
+		return ret, err
+	}
+	if err := checkPayloadSize(a.root.limit, "result of "+activity.GetInfo(ctx).ActivityType.Name, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+type payloadSizeWorkflowInbound struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *payloadSizeInterceptor
+}
+
+func (w *payloadSizeWorkflowInbound) Init(outbound interceptor.WorkflowOutboundInterceptor) error {
+	i := &payloadSizeWorkflowOutbound{root: w.root}
+	i.Next = outbound
+	return w.Next.Init(i)
+}
+
+type payloadSizeWorkflowOutbound struct {
+	interceptor.WorkflowOutboundInterceptorBase
+	root *payloadSizeInterceptor
+	// limit is the limit recorded in history, zero until read.
+	limit int
+}
+
+// check returns a PayloadTooLargeErrorType error if values encode to more
+// than the limit recorded in history.
+func (w *payloadSizeWorkflowOutbound) check(ctx workflow.Context, what string, values ...interface{}) error {
+	if w.limit == 0 {
+		err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+			return w.root.limit
+		}).Get(&w.limit)
+		if err != nil {
+			return err
+		}
+	}
+	return checkPayloadSize(w.limit, what, values...)
+}
+
+func (w *payloadSizeWorkflowOutbound) ExecuteActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	if err := w.check(ctx, "input of "+activityType, args...); err != nil {
+		return failedFuture(ctx, err)
+	}
+	return w.Next.ExecuteActivity(ctx, activityType, args...)
+}
+
+func (w *payloadSizeWorkflowOutbound) ExecuteLocalActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	if err := w.check(ctx, "input of "+activityType, args...); err != nil {
+		return failedFuture(ctx, err)
+	}
+	return w.Next.ExecuteLocalActivity(ctx, activityType, args...)
+}
+
+type payloadSizeClientOutbound struct {
+	interceptor.ClientOutboundInterceptorBase
+	root *payloadSizeInterceptor
+}
+
+func (c *payloadSizeClientOutbound) ExecuteWorkflow(
+	ctx context.Context,
+	in *interceptor.ClientExecuteWorkflowInput,
+) (client.WorkflowRun, error) {
+	if err := checkPayloadSize(c.root.limit, "input of "+in.WorkflowType, in.Args...); err != nil {
+		return nil, err
+	}
+	return c.Next.ExecuteWorkflow(ctx, in)
+}
+
+func (c *payloadSizeClientOutbound) SignalWorkflow(ctx context.Context, in *interceptor.ClientSignalWorkflowInput) error {
+	if err := checkPayloadSize(c.root.limit, "signal "+in.SignalName, in.Arg); err != nil {
+		return err
+	}
+	return c.Next.SignalWorkflow(ctx, in)
+}
+
+func (c *payloadSizeClientOutbound) SignalWithStartWorkflow(
+	ctx context.Context,
+	in *interceptor.ClientSignalWithStartWorkflowInput,
+) (client.WorkflowRun, error) {
+	if err := checkPayloadSize(c.root.limit, "signal "+in.SignalName, in.SignalArg); err != nil {
+		return nil, err
+	}
+	if err := checkPayloadSize(c.root.limit, "input of "+in.WorkflowType, in.Args...); err != nil {
+		return nil, err
+	}
+	return c.Next.SignalWithStartWorkflow(ctx, in)
+}
+
+func (c *payloadSizeClientOutbound) UpdateWorkflow(
+	ctx context.Context,
+	in *interceptor.ClientUpdateWorkflowInput,
+) (client.WorkflowUpdateHandle, error) {
+	if err := checkPayloadSize(c.root.limit, "update "+in.UpdateName, in.Args...); err != nil {
+		return nil, err
+	}
+	return c.Next.UpdateWorkflow(ctx, in)
+}
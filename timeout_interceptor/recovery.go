@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+)
+
+// ActivityPanicErrorType is the type of the ApplicationError a panicking
+// activity fails with. The error is retryable; list the type in
+// RetryPolicy.NonRetryableErrorTypes to fail the activity on the first panic.
+const ActivityPanicErrorType = "ActivityPanic"
+
+// panicInterceptor turns activity panics into application errors, with the
+// stack trace as details, so that workflows can handle them like any other
+// error type.
+type panicInterceptor struct {
+	interceptor.WorkerInterceptorBase
+}
+
+// NewActivityPanicInterceptor recovers from activity panics.
+func NewActivityPanicInterceptor() interceptor.WorkerInterceptor {
+	return &panicInterceptor{}
+}
+
+func (p *panicInterceptor) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	i := &panicActivityInbound{}
+	i.Next = next
+	return i
+}
+
+type panicActivityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+}
+
+func (a *panicActivityInbound) ExecuteActivity(
+	ctx context.Context,
+	in *interceptor.ExecuteActivityInput,
+) (ret interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := string(debug.Stack())
+			activity.GetLogger(ctx).Error("Activity panicked", "Panic", r, "StackTrace", stack)
+			ret, err = nil, temporal.NewApplicationError(fmt.Sprintf("activity panic: %v", r), ActivityPanicErrorType, stack)
+		}
+	}()
+	return a.Next.ExecuteActivity(ctx, in)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// TimeoutPolicyKey is the memo and header key overriding the TimeoutPolicy
+	// of a single workflow execution or activity.
+	TimeoutPolicyKey = "timeout-policy"
+	// TimeoutErrorType is the type of the ApplicationError returned when a
+	// workflow or activity exceeds its TimeoutPolicy.
+	TimeoutErrorType = "InterceptorTimeout"
+	// InvalidTimeoutPolicyErrorType is the type of the ApplicationError
+	// returned when the TimeoutPolicyKey or DeadlineHeaderKey value of a
+	// workflow or activity cannot be decoded.
+	InvalidTimeoutPolicyErrorType = "InvalidTimeoutPolicy"
+)
+
+// TimeoutPolicy bounds the duration of a workflow execution or activity. Once
+// Timeout elapsed its context is canceled, and it gets GracePeriod to clean up
+// before the interceptor fails it with a TimeoutErrorType error. A zero Timeout
+// disables the policy.
+//
+// TaskBudget bounds the wall-clock time workflow code runs for, summed over
+// the workflow tasks of an execution, see taskBudget. Exceeding it logs a
+// warning, or with FailOverBudget fails the workflow with a
+// TaskBudgetExceededErrorType error. It does not apply to activities.
+type TimeoutPolicy struct {
+	Timeout        time.Duration
+	GracePeriod    time.Duration
+	TaskBudget     time.Duration
+	FailOverBudget bool
+}
+
+type timeoutPolicyJSON struct {
+	Timeout        string `json:"timeout,omitempty"`
+	GracePeriod    string `json:"gracePeriod,omitempty"`
+	TaskBudget     string `json:"taskBudget,omitempty"`
+	FailOverBudget bool   `json:"failOverBudget,omitempty"`
+}
+
+// MarshalJSON encodes the durations as strings such as "1m30s".
+func (p TimeoutPolicy) MarshalJSON() ([]byte, error) {
+	j := timeoutPolicyJSON{FailOverBudget: p.FailOverBudget}
+	if p.Timeout > 0 {
+		j.Timeout = p.Timeout.String()
+	}
+	if p.GracePeriod > 0 {
+		j.GracePeriod = p.GracePeriod.String()
+	}
+	if p.TaskBudget > 0 {
+		j.TaskBudget = p.TaskBudget.String()
+	}
+	return json.Marshal(j)
+}
+
+func (p *TimeoutPolicy) UnmarshalJSON(data []byte) error {
+	var j timeoutPolicyJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*p = TimeoutPolicy{FailOverBudget: j.FailOverBudget}
+	var err error
+	if j.Timeout != "" {
+		if p.Timeout, err = time.ParseDuration(j.Timeout); err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+	}
+	if j.GracePeriod != "" {
+		if p.GracePeriod, err = time.ParseDuration(j.GracePeriod); err != nil {
+			return fmt.Errorf("gracePeriod: %w", err)
+		}
+	}
+	if j.TaskBudget != "" {
+		if p.TaskBudget, err = time.ParseDuration(j.TaskBudget); err != nil {
+			return fmt.Errorf("taskBudget: %w", err)
+		}
+	}
+	return nil
+}
+
+// TimeoutPolicies is the policy table of the timeout interceptor, keyed by
+// workflow and activity type. Types missing from the table get the defaults.
+// A workflow execution keeps the policy it started with, even if the table
+// changes meanwhile.
+type TimeoutPolicies struct {
+	DefaultWorkflow TimeoutPolicy            `json:"defaultWorkflow"`
+	DefaultActivity TimeoutPolicy            `json:"defaultActivity"`
+	Workflows       map[string]TimeoutPolicy `json:"workflows"`
+	Activities      map[string]TimeoutPolicy `json:"activities"`
+}
+
+// LoadTimeoutPolicies reads a policy table from a JSON file.
+func LoadTimeoutPolicies(path string) (TimeoutPolicies, error) {
+	var policies TimeoutPolicies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return policies, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return policies, nil
+}
+
+func (p TimeoutPolicies) workflow(workflowType string) TimeoutPolicy {
+	if policy, ok := p.Workflows[workflowType]; ok {
+		return policy
+	}
+	return p.DefaultWorkflow
+}
+
+func (p TimeoutPolicies) activity(activityType string) TimeoutPolicy {
+	if policy, ok := p.Activities[activityType]; ok {
+		return policy
+	}
+	return p.DefaultActivity
+}
+
+// overridePolicy returns the policy found in the first of payloads holding
+// one, or policy.
+func overridePolicy(policy TimeoutPolicy, payloads ...*commonpb.Payload) (TimeoutPolicy, error) {
+	for _, payload := range payloads {
+		if payload == nil {
+			continue
+		}
+		var override TimeoutPolicy
+		if err := converter.GetDefaultDataConverter().FromPayload(payload, &override); err != nil {
+			return policy, fmt.Errorf("decoding %s: %w", TimeoutPolicyKey, err)
+		}
+		return override, nil
+	}
+	return policy, nil
+}
+
+// newTimeoutError reports that a workflow or activity timed out, when being
+// the limit that fired, e.g. "after 10s".
+func newTimeoutError(kind, name, when string, cause error) error {
+	return temporal.NewNonRetryableApplicationError(
+		fmt.Sprintf("%s %s timed out %s", kind, name, when), TimeoutErrorType, cause)
+}
+
+type timeoutInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	policies TimeoutPolicies
+	// now is the wall clock of the task budgets, time.Now but in tests.
+	now func() time.Time
+}
+
+// NewTimeoutInterceptor applies duration to every workflow execution.
+func NewTimeoutInterceptor(duration time.Duration) interceptor.WorkerInterceptor {
+	return NewPolicyTimeoutInterceptor(TimeoutPolicies{DefaultWorkflow: TimeoutPolicy{Timeout: duration}})
+}
+
+// NewPolicyTimeoutInterceptor applies the policies of the table to workflows
+// and activities. A policy found in the TimeoutPolicyKey header, or for
+// workflows in the TimeoutPolicyKey memo, takes precedence over the table.
+// The deadline of a workflow is propagated to its activities and child
+// workflows, see workflowOutboundInterceptor.
+func NewPolicyTimeoutInterceptor(policies TimeoutPolicies) interceptor.WorkerInterceptor {
+	return &timeoutInterceptor{policies: policies, now: time.Now}
+}
+
+func (w *timeoutInterceptor) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	i := &activityInboundInterceptor{root: w}
+	i.Next = next
+	return i
+}
+
+func (w *timeoutInterceptor) InterceptWorkflow(
+	ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor,
+) interceptor.WorkflowInboundInterceptor {
+	i := &workflowInboundInterceptor{root: w}
+	i.Next = next
+	return i
+}
+
+type workflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *timeoutInterceptor
+	// deadline is when the workflow context is canceled, zero if never. The
+	// workflow is failed gracePeriod later.
+	deadline    time.Time
+	gracePeriod time.Duration
+	budget      taskBudget
+}
+
+func (t *workflowInboundInterceptor) Init(outbound interceptor.WorkflowOutboundInterceptor) error {
+	i := &workflowOutboundInterceptor{inbound: t}
+	i.Next = outbound
+	return t.Next.Init(i)
+}
+
+func (t *workflowInboundInterceptor) ExecuteWorkflow(
+	ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput,
+) (interface{}, error) {
+	info := workflow.GetInfo(ctx)
+	// The policy table may change between worker restarts: the policy of the
+	// execution is recorded in history, so that replaying it sets the same
+	// timers.
+	var policy TimeoutPolicy
+	err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+		return t.root.policies.workflow(info.WorkflowType.Name)
+	}).Get(&policy)
+	if err != nil {
+		return nil, err
+	}
+	policy, err = overridePolicy(policy,
+		interceptor.WorkflowHeader(ctx)[TimeoutPolicyKey], info.Memo.GetFields()[TimeoutPolicyKey])
+	if err != nil {
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), InvalidTimeoutPolicyErrorType, err)
+	}
+	parentDeadline, err := headerDeadline(interceptor.WorkflowHeader(ctx))
+	if err != nil {
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), InvalidTimeoutPolicyErrorType, err)
+	}
+	now := workflow.Now(ctx)
+	var when string
+	if policy.Timeout > 0 {
+		t.deadline, when = now.Add(policy.Timeout), "after "+policy.Timeout.String()
+	}
+	if !parentDeadline.IsZero() && (t.deadline.IsZero() || parentDeadline.Before(t.deadline)) {
+		t.deadline, when = parentDeadline, "at the parent deadline "+parentDeadline.Format(time.RFC3339Nano)
+	}
+	t.gracePeriod = policy.GracePeriod
+	t.budget = taskBudget{limit: policy.TaskBudget, fail: policy.FailOverBudget, now: t.root.now}
+	defer t.budget.recordTotal(ctx)
+	if t.deadline.IsZero() && t.budget.limit <= 0 {
+		return t.Next.ExecuteWorkflow(ctx, in)
+	}
+	timeout := t.deadline.Sub(now)
+
+	// The workflow runs in its own coroutine, so that it can be abandoned
+	// once the grace period is over or it exceeded its task budget, and timed
+	// by the polls of the conditions waiting for it.
+	ctxTmt, cancel := workflow.WithCancel(ctx)
+	var (
+		ret  interface{}
+		done bool
+	)
+	workflow.Go(ctxTmt, func(ctx workflow.Context) {
+		ret, err = t.Next.ExecuteWorkflow(ctx, in)
+		done = true
+	})
+	isDone := t.budget.polling(ctx, func() bool { return done })
+	isDoneOrOverBudget := t.budget.polling(ctx, func() bool { return done || t.budget.failing() && t.budget.exceeded })
+	var (
+		ok       bool
+		awaitErr error
+	)
+	if t.deadline.IsZero() {
+		awaitErr = workflow.Await(ctx, isDoneOrOverBudget)
+		ok = awaitErr == nil
+	} else if timeout > 0 {
+		ok, awaitErr = workflow.AwaitWithTimeout(ctx, timeout, isDoneOrOverBudget)
+	}
+	if ok && done {
+		return ret, err
+	}
+	if ok {
+		cancel()
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("workflow %s exceeded its task budget of %s", info.WorkflowType.Name, t.budget.limit),
+			TaskBudgetExceededErrorType, nil)
+	}
+	disconnected, _ := workflow.NewDisconnectedContext(ctx)
+	if awaitErr != nil {
+		// The workflow itself is canceled: let it handle the cancellation.
+		_ = workflow.Await(disconnected, isDone)
+		return ret, err
+	}
+
+	cancel()
+	if policy.GracePeriod > 0 {
+		_, _ = workflow.AwaitWithTimeout(disconnected, policy.GracePeriod, isDone)
+	}
+	if !done {
+		workflow.GetLogger(ctx).Warn("Workflow did not finish its clean up within the grace period",
+			"GracePeriod", policy.GracePeriod)
+		err = nil
+	}
+	return nil, newTimeoutError("workflow", info.WorkflowType.Name, when, err)
+}
+
+type activityInboundInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *timeoutInterceptor
+}
+
+func (a *activityInboundInterceptor) ExecuteActivity(
+	ctx context.Context,
+	in *interceptor.ExecuteActivityInput,
+) (interface{}, error) {
+	info := activity.GetInfo(ctx)
+	policy, err := overridePolicy(a.root.policies.activity(info.ActivityType.Name),
+		interceptor.Header(ctx)[TimeoutPolicyKey])
+	if err != nil {
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), InvalidTimeoutPolicyErrorType, err)
+	}
+	// The deadline of the calling workflow bounds the activity too, and is
+	// reported when it comes first.
+	deadline, err := headerDeadline(interceptor.Header(ctx))
+	if err != nil {
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), InvalidTimeoutPolicyErrorType, err)
+	}
+	var expiry time.Time
+	var when string
+	if policy.Timeout > 0 {
+		expiry, when = time.Now().Add(policy.Timeout), "after "+policy.Timeout.String()
+	}
+	if !deadline.IsZero() && (expiry.IsZero() || deadline.Before(expiry)) {
+		expiry, when = deadline, "at the workflow deadline "+deadline.Format(time.RFC3339Nano)
+	}
+	if expiry.IsZero() {
+		return a.Next.ExecuteActivity(ctx, in)
+	}
+
+	ctxTmt, cancel := context.WithDeadline(ctx, expiry)
+	defer cancel()
+	type result struct {
+		ret interface{}
+		err error
+	}
+	// Buffered, so that an activity abandoned after the grace period does not
+	// block forever once it returns.
+	results := make(chan result, 1)
+	go func() {
+		ret, err := a.Next.ExecuteActivity(ctxTmt, in)
+		results <- result{ret, err}
+	}()
+
+	var r result
+	select {
+	case r = <-results:
+		if !errors.Is(ctxTmt.Err(), context.DeadlineExceeded) {
+			return r.ret, r.err
+		}
+	case <-ctxTmt.Done():
+		if ctx.Err() != nil {
+			// The activity itself is canceled or timed out.
+			r = <-results
+			return r.ret, r.err
+		}
+		select {
+		case r = <-results:
+		case <-time.After(policy.GracePeriod):
+			activity.GetLogger(ctx).Warn("Activity did not return within the grace period",
+				"GracePeriod", policy.GracePeriod)
+		}
+	}
+	return nil, newTimeoutError("activity", info.ActivityType.Name, when, r.err)
+}